@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stdinName = "-"
+const defaultCacheSize = 41
+
+// options holds settings given in command line
+type options struct {
+	files     []string
+	startLine uint      // index of the first line to show
+	startTime time.Time // time of the first line to show, zero if not given
+	filters   []string  // filter expressions, each narrowing the previous one
+	before    uint      // number of context lines before matching lines
+	after     uint      // number of context lines after matching lines
+	cacheSize uint
+	printMode bool
+	follow    bool
+	merge     bool     // show lines of all files in one view, in order of time
+	records   string   // start pattern of records filtered as a whole, empty for lines
+	format    string   // name of the log format, empty to detect it
+	columns   []string // fields shown as columns of structured logs, nil for the default ones
+	formats   string   // file with definitions of log formats, empty for the default one
+	styles    string   // file with styles of levels and tokens, empty for the default one
+	encoding  string   // encoding of the files, empty to detect it
+	stripANSI bool     // ANSI escape codes are removed instead of coloring lines
+	tabWidth  uint
+	count     uint // number of lines to print, 0 means all
+}
+
+// stringList is a flag, which can be given many times
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ", ")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+const usage = `Usage: logviewer [+N] [options] file...
+
+Shows given files. Use "-" to read from stdin.
+  +N	start at line N (1-based)
+`
+
+// parseArgs parses command line arguments, without the program name
+func parseArgs(args []string, output io.Writer) (*options, error) {
+	result := &options{}
+
+	fs := flag.NewFlagSet("logviewer", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprint(output, usage)
+		fs.PrintDefaults()
+	}
+	fs.Var((*stringList)(&result.filters), "filter", "show only lines matching the filter expression, can be repeated")
+	var context uint
+	var at string
+	fs.StringVar(&at, "at", "", "start at the first line with a timestamp not before given time")
+	fs.UintVar(&result.before, "B", 0, "number of context lines before matching lines")
+	fs.UintVar(&result.after, "A", 0, "number of context lines after matching lines")
+	fs.UintVar(&context, "C", 0, "number of context lines around matching lines, unless -A or -B is given")
+	fs.StringVar(&result.records, "records", "", "filter records starting with lines matching the pattern: timestamp, indent or /regexp/")
+	fs.StringVar(&result.format, "format", "", "format of the log: plain, json, logfmt, syslog or a user defined one, detected if not given")
+	fs.StringVar(&result.formats, "formats", "", "file with definitions of log formats, "+defaultFormatsPath()+" by default")
+	fs.StringVar(&result.styles, "styles", "", "file with styles of levels and tokens, "+defaultStylesPath()+" by default")
+	fs.StringVar(&result.encoding, "encoding", "", "encoding of the files: utf-8, utf-16le, utf-16be, windows-1252, latin1 or shift-jis, detected if not given")
+	fs.BoolVar(&result.stripANSI, "strip-ansi", false, "remove ANSI escape codes from lines instead of showing their colors")
+	fs.UintVar(&result.tabWidth, "tabs", defaultTabWidth, "distance of tab stops")
+	columns := fs.String("columns", strings.Join(defaultColumns, ","), "fields shown as columns of structured logs")
+	fs.UintVar(&result.cacheSize, "cache", defaultCacheSize, "number of lines read from the file at once")
+	fs.BoolVar(&result.printMode, "print", false, "write lines to stdout instead of showing them")
+	fs.UintVar(&result.count, "count", 0, "number of lines written in print mode, 0 for all")
+	fs.BoolVar(&result.follow, "follow", false, "show lines appended to the files")
+	fs.BoolVar(&result.merge, "merge", false, "show lines of all files together, ordered by their timestamps")
+
+	var rest []string
+	startLineGiven := false
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "+") {
+			startLineGiven = true
+			n, err := strconv.ParseUint(arg[1:], 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start line %q", arg)
+			}
+			if n > 0 {
+				result.startLine = uint(n - 1)
+			}
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	if err := fs.Parse(rest); err != nil {
+		return nil, err
+	}
+	result.files = fs.Args()
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if !given["B"] {
+		result.before = context
+	}
+	if !given["A"] {
+		result.after = context
+	}
+
+	if at != "" {
+		if startLineGiven {
+			return nil, errors.New("-at cannot be used with +N")
+		}
+		t, err := parseTimeArg(at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q", at)
+		}
+		result.startTime = t
+	}
+
+	if len(result.files) == 0 {
+		fs.Usage()
+		return nil, errors.New("no file given")
+	}
+	stdinCount := 0
+	for _, f := range result.files {
+		if f == stdinName {
+			stdinCount++
+		}
+	}
+	if stdinCount > 1 {
+		return nil, errors.New("stdin can be given only once")
+	}
+	for _, expression := range result.filters {
+		if _, err := newFilter(expression, plainTextField); err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", expression, err)
+		}
+	}
+	formatsPath := result.formats
+	if formatsPath == "" {
+		formatsPath = defaultFormatsPath()
+	}
+	if err := loadLogFormats(formatsPath, result.formats != ""); err != nil {
+		return nil, fmt.Errorf("invalid formats: %v", err)
+	}
+	if _, ok := findLogFormat(result.format); !ok && result.format != "" {
+		return nil, fmt.Errorf("unknown format %q", result.format)
+	}
+	if result.tabWidth == 0 {
+		return nil, errors.New("-tabs must be positive")
+	}
+	if result.encoding != "" {
+		if _, err := findEncoding(result.encoding); err != nil {
+			return nil, err
+		}
+	}
+	if given["columns"] {
+		result.columns = strings.Split(*columns, ",")
+	}
+	if result.records != "" {
+		if _, err := newRecordStart(result.records, nil); err != nil {
+			return nil, fmt.Errorf("invalid records: %v", err)
+		}
+	}
+	if result.merge && (len(result.filters) != 0 || result.before != 0 || result.after != 0 || result.records != "") {
+		return nil, errors.New("filters cannot be used with -merge")
+	}
+	if result.cacheSize <= marginLinesCount {
+		return nil, fmt.Errorf("cache size must be greater than %v", marginLinesCount)
+	}
+	return result, nil
+}
+
+// openInput opens file of given name. Stdin is not seekable, so it is read
+// into memory. Compressed files are decompressed transparently
+func openInput(name string, stdin io.Reader) (io.ReadSeeker, io.Closer, error) {
+	if name == stdinName {
+		b, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		rs, err := newDecompressedFile(bytes.NewReader(b))
+		return rs, ioutil.NopCloser(nil), err
+	}
+	f, err := openNamedFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	rs, err := newDecompressedFile(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return rs, f, nil
+}
+
+// displayName returns name of the input shown to the user
+func displayName(name string) string {
+	if name == stdinName {
+		return "(stdin)"
+	}
+	return name
+}
+
+// openTextFile returns text file of the input, indexed in background
+func openTextFile(rs io.ReadSeeker, opts *options) *TextFile {
+	tf := NewTextFile(rs, opts.cacheSize)
+	if opts.encoding != "" {
+		enc, _ := findEncoding(opts.encoding)
+		tf.setEncoding(enc)
+	}
+	tf.startIndexing()
+	return tf
+}
+
+// logFormatOf returns format of the file given in options or detected from
+// its first lines, nil for plain text
+func logFormatOf(tf *TextFile, opts *options) *logFormat {
+	if opts.format == "" {
+		return detectLogFormat(tf.firstLines(formatDetectionLines))
+	}
+	format, _ := findLogFormat(opts.format)
+	return format
+}
+
+// newFilteredSource returns filter stack of the file with a layer for each of
+// the filter expressions. Fields of lines are read in given format
+func newFilteredSource(tf *TextFile, format *logFormat, opts *options) (*filterStack, error) {
+	fields := plainTextField
+	if format != nil {
+		fields = format.field
+	}
+	result := newFilterStack(tf, fields)
+	result.setContext(opts.before, opts.after)
+	if opts.records != "" {
+		start, err := newRecordStart(opts.records, tf)
+		if err != nil {
+			return nil, err
+		}
+		result.setRecords(start)
+	}
+	for _, expression := range opts.filters {
+		if err := result.push(expression); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// newMergedSource returns merged view of the inputs
+func newMergedSource(inputs []io.ReadSeeker, opts *options) *mergedFile {
+	var sources []mergedSource
+	for n, rs := range inputs {
+		tf := openTextFile(rs, opts)
+		tf.logFormat = logFormatOf(tf, opts)
+		sources = append(sources, mergedSource{displayName(opts.files[n]), tf})
+	}
+	return newMergedFile(sources, opts.cacheSize)
+}
+
+// startLineOf returns index of the first line to show, the one at the start
+// time if it was given
+func startLineOf(src lineSource, opts *options) uint {
+	if ts, ok := src.(timed); ok && !opts.startTime.IsZero() {
+		return ts.lineOfTime(opts.startTime)
+	}
+	return opts.startLine
+}
+
+// printLines writes lines of the source to w, starting at the start line. If
+// context lines are shown, matching lines are marked with "> ". Lines of the
+// merged view are tagged with names of their files
+func printLines(w io.Writer, src lineSource, opts *options) error {
+	withContext := opts.before != 0 || opts.after != 0
+	mf, merged := src.(*mergedFile)
+	if s, ok := src.(searching); ok {
+		s.wait()
+	}
+	row := src.rowOfLine(startLineOf(src, opts))
+	var written uint
+	for {
+		chunk := src.lines(row, opts.cacheSize)
+		for _, line := range chunk {
+			if opts.count != 0 && written == opts.count {
+				return nil
+			}
+			prefix := ""
+			if withContext && line.isContext {
+				prefix = "  "
+			} else if withContext {
+				prefix = "> "
+			}
+			if merged {
+				prefix += mf.tag(line)
+			}
+			if _, err := fmt.Fprintln(w, prefix+line.Contents); err != nil {
+				return err
+			}
+			written++
+		}
+		if uint(len(chunk)) < opts.cacheSize {
+			// the file may end early, because it could not be read
+			if f, ok := src.(failing); ok {
+				return f.lastError()
+			}
+			return nil
+		}
+		row += uint(len(chunk))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	testCases := []struct {
+		args        []string
+		expectedErr bool
+		expected    options
+	}{
+		{
+			args:     []string{"a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth}},
+		{
+			args:     []string{"+10", "-filter", "ERROR", "-cache", "5", "-filter", "db1", "a.log", "-"},
+			expected: options{files: []string{"a.log", "-"}, startLine: 9, filters: []string{"ERROR", "db1"}, cacheSize: 5, tabWidth: defaultTabWidth}},
+		{
+			args:     []string{"--print", "-count", "3", "+1", "-"},
+			expected: options{files: []string{"-"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, printMode: true, count: 3}},
+		{
+			args:     []string{"-C", "2", "-A", "1", "a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, before: 2, after: 1}},
+		{
+			args:     []string{"-merge", "a.log", "b.log"},
+			expected: options{files: []string{"a.log", "b.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, merge: true}},
+		{
+			args:     []string{"-at", "2019-11-25 10:00:00", "a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, startTime: time.Date(2019, 11, 25, 10, 0, 0, 0, time.UTC)}},
+		{
+			args:     []string{"-records", "/^\\S/", "-filter", "Exception", "a.log"},
+			expected: options{files: []string{"a.log"}, filters: []string{"Exception"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, records: "/^\\S/"}},
+		{
+			args:     []string{"-format", "json", "-columns", "ts,msg", "a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, format: "json", columns: []string{"ts", "msg"}}},
+		{
+			args:     []string{"-strip-ansi", "-tabs", "4", "a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: 4, stripANSI: true}},
+		{
+			args:     []string{"-encoding", "latin1", "a.log"},
+			expected: options{files: []string{"a.log"}, cacheSize: defaultCacheSize, tabWidth: defaultTabWidth, encoding: "latin1"}},
+		{
+			args:        []string{},
+			expectedErr: true},
+		{
+			args:        []string{"-encoding", "ebcdic", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-tabs", "0", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-format", "xml", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-records", "paragraphs", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-at", "yesterday", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"+3", "-at", "2019-11-25", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-merge", "-filter", "a", "a.log", "b.log"},
+			expectedErr: true},
+		{
+			args:        []string{"+x", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-", "-"},
+			expectedErr: true},
+		{
+			args:        []string{"-cache", "1", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-unknown", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-filter", "(a or b", "a.log"},
+			expectedErr: true},
+		{
+			args:        []string{"-filter", "a", "-filter", "", "a.log"},
+			expectedErr: true},
+	}
+
+	for n, c := range testCases {
+		opts, err := parseArgs(c.args, ioutil.Discard)
+		if observedErr := err != nil; observedErr != c.expectedErr {
+			t.Errorf("Case %v: parseArgs() error. want: %v, have: %v", n, c.expectedErr, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*opts, c.expected) {
+			t.Errorf("Case %v: want: %+v, have: %+v", n, c.expected, *opts)
+		}
+	}
+}
+
+func TestPrintLines(t *testing.T) {
+	testCases := []struct {
+		opts     options
+		expected string
+	}{
+		{
+			opts:     options{cacheSize: 2},
+			expected: "a0\nb1\na2\nb3\na4\n"},
+		{
+			opts:     options{cacheSize: 2, startLine: 3},
+			expected: "b3\na4\n"},
+		{
+			opts:     options{cacheSize: 2, count: 3},
+			expected: "a0\nb1\na2\n"},
+		{
+			opts:     options{cacheSize: 2, filters: []string{"a"}},
+			expected: "a0\na2\na4\n"},
+		{
+			opts:     options{cacheSize: 3, filters: []string{"a"}, startLine: 1, count: 1},
+			expected: "a2\n"},
+		{
+			opts:     options{cacheSize: 2, startLine: 10},
+			expected: ""},
+		{
+			opts:     options{cacheSize: 2, filters: []string{"a or not /[0-2]/"}},
+			expected: "a0\na2\nb3\na4\n"},
+		{
+			opts:     options{cacheSize: 2, filters: []string{"a or b", "not 0", "/[0-3]/"}},
+			expected: "b1\na2\nb3\n"},
+		{
+			opts:     options{cacheSize: 2, filters: []string{"b1 or a4"}, before: 1},
+			expected: "  a0\n> b1\n  b3\n> a4\n"},
+	}
+
+	for n, c := range testCases {
+		var out bytes.Buffer
+		rs, _, _ := openInput(stdinName, bytes.NewBufferString("a0\nb1\na2\nb3\na4\n"))
+		src, err := newFilteredSource(openTextFile(rs, &c.opts), nil, &c.opts)
+		if err != nil {
+			t.Errorf("Case %v: newFilteredSource() failed: %v", n, err)
+			continue
+		}
+		if err := printLines(&out, src, &c.opts); err != nil {
+			t.Errorf("Case %v: printLines() failed: %v", n, err)
+		}
+		if out.String() != c.expected {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, out.String())
+		}
+	}
+}
+
+func TestPrintMergedLines(t *testing.T) {
+	opts := options{files: []string{"a.log", "-"}, cacheSize: 2, merge: true, startLine: 1}
+	var inputs []io.ReadSeeker
+	for _, contents := range []string{"2019-11-25T10:00:01Z a1\n2019-11-25T10:00:03Z a3\n", "2019-11-25T10:00:02Z b2\n"} {
+		rs, _, _ := openInput(stdinName, bytes.NewBufferString(contents))
+		inputs = append(inputs, rs)
+	}
+	var out bytes.Buffer
+	if err := printLines(&out, newMergedSource(inputs, &opts), &opts); err != nil {
+		t.Errorf("printLines() failed: %v", err)
+	}
+	expected := "[(stdin)] 2019-11-25T10:00:02Z b2\n[a.log  ] 2019-11-25T10:00:03Z a3\n"
+	if out.String() != expected {
+		t.Errorf("want: %q, have: %q", expected, out.String())
+	}
+
+	opts.startLine = 0
+	opts.startTime = time.Date(2019, 11, 25, 10, 0, 3, 0, time.UTC)
+	out.Reset()
+	printLines(&out, newMergedSource(inputs, &opts), &opts)
+	if expected := "[a.log  ] 2019-11-25T10:00:03Z a3\n"; out.String() != expected {
+		t.Errorf("-at want: %q, have: %q", expected, out.String())
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import "sort"
+
+// contextLines is a matchSource of matching lines together with up to before
+// lines preceding and after lines following each of them, like grep -B and
+// -A. Context of near matches is merged, so no line is shown twice
+type contextLines struct {
+	tf       *TextFile
+	input    matchSource
+	before   uint
+	after    uint
+	rows     []matchingLine
+	consumed uint // number of input rows already expanded
+	end      uint // index of the line following context of the last match
+}
+
+func newContextLines(tf *TextFile, input matchSource, before uint, after uint) *contextLines {
+	result := &contextLines{}
+	result.tf = tf
+	result.input = input
+	result.before = before
+	result.after = after
+	return result
+}
+
+// nextIndex returns index of the line following the last row
+func (cl *contextLines) nextIndex() uint {
+	if len(cl.rows) == 0 {
+		return 0
+	}
+	return cl.rows[len(cl.rows)-1].index + 1
+}
+
+// appendContext appends lines from first up to end as rows, read at once.
+// Lines already in rows are skipped. All of them are context rows, except the
+// match, if it is not nil
+func (cl *contextLines) appendContext(first uint, end uint, match *matchingLine) {
+	if next := cl.nextIndex(); first < next {
+		first = next
+	}
+	if first < end {
+		for n, line := range cl.tf.lines(first, end-first) {
+			index := first + uint(n)
+			isContext := match == nil || index != match.index
+			cl.rows = append(cl.rows, matchingLine{index: index, position: line.position, isContext: isContext})
+		}
+	}
+	// the match is kept, even if reading lines around it failed
+	if match != nil && cl.nextIndex() <= match.index {
+		cl.rows = append(cl.rows, matchingLine{index: match.index, position: match.position})
+	}
+}
+
+// expandMore adds next batch of input rows with their context. It returns
+// false if there is nothing more to add at the moment
+func (cl *contextLines) expandMore() bool {
+	// lines following the last match may have been appended to the file
+	rowsCount := len(cl.rows)
+	cl.appendContext(0, cl.end, nil)
+
+	batch := completeMatches(cl.input.matchesAt(cl.consumed, narrowBatchSize))
+	for n := range batch {
+		m := &batch[n]
+		if next := cl.nextIndex(); m.index < next {
+			// the match is already a context row of the previous one
+			cl.rows[len(cl.rows)-int(next-m.index)].isContext = false
+		}
+		first := uint(0)
+		if m.index > cl.before {
+			first = m.index - cl.before
+		}
+		// lines before the match, the match and lines after it
+		cl.end = m.index + cl.after + 1
+		cl.appendContext(first, cl.end, m)
+	}
+	cl.consumed += uint(len(batch))
+	return len(batch) != 0 || len(cl.rows) != rowsCount
+}
+
+func (cl *contextLines) matchesAt(first uint, count uint) []matchingLine {
+	for uint(len(cl.rows)) < first+count && cl.expandMore() {
+	}
+	var result []matchingLine
+	for row := first; row < first+count && row < uint(len(cl.rows)); row++ {
+		result = append(result, cl.rows[row])
+	}
+	return result
+}
+
+func (cl *contextLines) lines(first uint, count uint) []FileLine {
+	var result []FileLine
+	for _, m := range cl.matchesAt(first, count) {
+		line := cl.tf.lineAt(m.position)
+		line.isContext = m.isContext
+		result = append(result, line)
+	}
+	return result
+}
+
+func (cl *contextLines) rowOfLine(lineIndex uint) uint {
+	for {
+		row := sort.Search(len(cl.rows), func(i int) bool {
+			return cl.rows[i].index >= lineIndex
+		})
+		if row < len(cl.rows) || !cl.expandMore() {
+			return uint(row)
+		}
+	}
+}
+
+// rowsCount is known when all input rows were expanded. Context of the last
+// match may still grow with the file, but it is not waited for
+func (cl *contextLines) rowsCount() (uint, bool) {
+	count, known := cl.input.rowsCount()
+	if !known || cl.consumed != count {
+		return 0, false
+	}
+	return uint(len(cl.rows)), true
+}
+
+// update passes changes of the input. If the file grew, context of the last
+// match may be completed
+func (cl *contextLines) update() fileChange {
+	change := cl.input.update()
+	switch change {
+	case fileTruncated, fileRotated:
+		cl.rows = nil
+		cl.consumed = 0
+		cl.end = 0
+	case fileGrew:
+		cl.appendContext(0, cl.end, nil)
+	}
+	return change
+}
+
+func (cl *contextLines) progress() (int64, int64, bool) {
+	if s, ok := cl.input.(searching); ok {
+		return s.progress()
+	}
+	return 0, 0, false
+}
+
+func (cl *contextLines) wait() {
+	if s, ok := cl.input.(searching); ok {
+		s.wait()
+	}
+}
@@ -0,0 +1,804 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// decompressSpan is the least distance between decompression checkpoints, in
+// bytes of decompressed data
+var decompressSpan int64 = 1 << 20
+
+// decompressCheckpoint is a position, where decompression can start
+type decompressCheckpoint struct {
+	out    int64  // position in decompressed data
+	in     int64  // position in compressed data, in bits for gzip
+	window []byte // data preceding out, needed to resume gzip
+	check  byte   // type of checks of xz blocks, needed to resume xz
+}
+
+// compressionFormat is a format of compressed files recognized by its magic
+// bytes
+type compressionFormat struct {
+	name  string
+	magic []byte
+	// open returns decompressed data starting at the checkpoint, or at the
+	// beginning if it is nil. Checkpoints passed while reading are given to add
+	open func(ra io.ReaderAt, cp *decompressCheckpoint, add func(decompressCheckpoint)) (io.Reader, error)
+}
+
+var compressionFormats = []compressionFormat{
+	{"gzip", []byte{0x1f, 0x8b}, openGzip},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}, openZstd},
+	{"bzip2", []byte("BZh"), openBzip2},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, openXz},
+}
+
+// decompressedFile is a seekable view of decompressed data of a file.
+// Checkpoints are recorded while the data is read, so going back decompresses
+// the data only from the nearest checkpoint
+type decompressedFile struct {
+	mu          sync.Mutex
+	ra          io.ReaderAt
+	format      *compressionFormat
+	checkpoints []decompressCheckpoint
+	r           io.Reader // decompressed data at position rpos, nil if not open
+	rpos        int64
+	size        int64 // size of decompressed data, -1 until its end is reached
+	pos         int64 // position of Read
+}
+
+// newDecompressedFile returns decompressed data of rs, if its format is
+// recognized, or rs itself otherwise
+func newDecompressedFile(rs io.ReadSeeker) (io.ReadSeeker, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 6)
+	n, err := io.ReadFull(rs, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	for i := range compressionFormats {
+		if bytes.HasPrefix(magic[:n], compressionFormats[i].magic) {
+			result := &decompressedFile{}
+			result.format = &compressionFormats[i]
+			result.size = -1
+			ra, ok := rs.(io.ReaderAt)
+			if !ok {
+				ra = &seekingReaderAt{rs: rs}
+			}
+			result.ra = ra
+			return result, nil
+		}
+	}
+	return rs, nil
+}
+
+// addCheckpoint records the checkpoint, if it is far enough from the last one
+func (df *decompressedFile) addCheckpoint(cp decompressCheckpoint) {
+	if n := len(df.checkpoints); n != 0 && cp.out < df.checkpoints[n-1].out+decompressSpan {
+		return
+	}
+	cp.window = append([]byte(nil), cp.window...)
+	df.checkpoints = append(df.checkpoints, cp)
+}
+
+// checkpointBefore returns the last checkpoint not after the position, nil if
+// decompression has to start from the beginning
+func (df *decompressedFile) checkpointBefore(off int64) *decompressCheckpoint {
+	n := sort.Search(len(df.checkpoints), func(i int) bool {
+		return df.checkpoints[i].out > off
+	})
+	if n == 0 {
+		return nil
+	}
+	return &df.checkpoints[n-1]
+}
+
+// seekData moves the decompressing reader to the position. It continues with
+// the open reader if no checkpoint is closer
+func (df *decompressedFile) seekData(off int64) error {
+	cp := df.checkpointBefore(off)
+	var cpOut int64
+	if cp != nil {
+		cpOut = cp.out
+	}
+	if df.r == nil || off < df.rpos || df.rpos < cpOut {
+		r, err := df.format.open(df.ra, cp, df.addCheckpoint)
+		if err != nil {
+			return fmt.Errorf("%v: %v", df.format.name, err)
+		}
+		df.r = r
+		df.rpos = cpOut
+	}
+	if off > df.rpos {
+		n, err := io.CopyN(ioutil.Discard, df.r, off-df.rpos)
+		df.rpos += n
+		if err != nil {
+			return df.readError(err)
+		}
+	}
+	return nil
+}
+
+// readError records the end of data or drops the reader after an error
+func (df *decompressedFile) readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		df.size = df.rpos
+		err = io.EOF
+	} else {
+		err = fmt.Errorf("%v: %v", df.format.name, err)
+	}
+	df.r = nil
+	return err
+}
+
+func (df *decompressedFile) readAt(p []byte, off int64) (int, error) {
+	if df.size >= 0 && off >= df.size {
+		return 0, io.EOF
+	}
+	if err := df.seekData(off); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(df.r, p)
+	df.rpos += int64(n)
+	if err != nil {
+		return n, df.readError(err)
+	}
+	return n, nil
+}
+
+// ReadAt is safe for concurrent use, but reads are not parallel
+func (df *decompressedFile) ReadAt(p []byte, off int64) (int, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	return df.readAt(p, off)
+}
+
+func (df *decompressedFile) Read(p []byte) (int, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	n, err := df.readAt(p, df.pos)
+	df.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek relative to the end decompresses the data up to the end, when it is
+// done for the first time
+func (df *decompressedFile) Seek(offset int64, whence int) (int64, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	switch whence {
+	case io.SeekCurrent:
+		offset += df.pos
+	case io.SeekEnd:
+		size, err := df.end()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	df.pos = offset
+	return offset, nil
+}
+
+// end returns size of the decompressed data, which are decompressed up to the
+// end, if it was not reached yet
+func (df *decompressedFile) end() (int64, error) {
+	if df.size < 0 {
+		if err := df.seekData(math.MaxInt64); err != io.EOF {
+			return 0, err
+		}
+	}
+	return df.size, nil
+}
+
+// knownSize returns size of the decompressed data, it is not known until the
+// end was reached
+func (df *decompressedFile) knownSize() (int64, bool) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	if df.size < 0 {
+		return 0, false
+	}
+	return df.size, true
+}
+
+// readSize decompresses the data up to the end and returns their size.
+// Position of Read is kept
+func (df *decompressedFile) readSize() (int64, error) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+	return df.end()
+}
+
+// readerFrom returns reader of ra starting at the position
+func readerFrom(ra io.ReaderAt, off int64) io.Reader {
+	return io.NewSectionReader(ra, off, math.MaxInt64-off)
+}
+
+// gzipStream decompresses members of a gzip file
+type gzipStream struct {
+	f *inflater
+}
+
+// readGzipHeader reads header of a gzip member, following its first byte
+func readGzipHeader(br *bitReader, id1 byte) error {
+	var header [10]byte
+	header[0] = id1
+	for i := 1; i < len(header); i++ {
+		b, err := br.readByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		header[i] = b
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[2] != 8 {
+		return errors.New("invalid header")
+	}
+	skip := func(n int) error {
+		for ; n > 0; n-- {
+			if _, err := br.readByte(); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		return nil
+	}
+	skipString := func() error {
+		for {
+			b, err := br.readByte()
+			if err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if b == 0 {
+				return nil
+			}
+		}
+	}
+	flags := header[3]
+	if flags&0x04 != 0 {
+		lo, err1 := br.readByte()
+		hi, err2 := br.readByte()
+		if err1 != nil || err2 != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if err := skip(int(lo) | int(hi)<<8); err != nil {
+			return err
+		}
+	}
+	for _, flag := range []byte{0x08, 0x10} {
+		if flags&flag != 0 {
+			if err := skipString(); err != nil {
+				return err
+			}
+		}
+	}
+	if flags&0x02 != 0 {
+		return skip(2)
+	}
+	return nil
+}
+
+// Read continues with the next member, when one ends. Data following the last
+// member is ignored, like gzip does
+func (g *gzipStream) Read(p []byte) (int, error) {
+	for {
+		n, err := g.f.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		br := g.f.br
+		br.alignToByte()
+		for i := 0; i < 8; i++ {
+			if _, err := br.readByte(); err != nil {
+				return 0, io.ErrUnexpectedEOF
+			}
+		}
+		id1, err := br.readByte()
+		if err != nil || id1 != 0x1f {
+			return 0, io.EOF
+		}
+		if err := readGzipHeader(br, id1); err != nil {
+			return 0, err
+		}
+		g.f.nextStream()
+	}
+}
+
+func openGzip(ra io.ReaderAt, cp *decompressCheckpoint, add func(decompressCheckpoint)) (io.Reader, error) {
+	var start int64
+	if cp != nil {
+		start = cp.in
+	}
+	br := &bitReader{}
+	br.r = bufio.NewReader(readerFrom(ra, start/8))
+	br.offset = start / 8 * 8
+	g := &gzipStream{}
+	if cp == nil {
+		id1, err := br.readByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err := readGzipHeader(br, id1); err != nil {
+			return nil, err
+		}
+		g.f = newInflater(br, nil, 0)
+	} else {
+		if _, err := br.read(uint(start % 8)); err != nil {
+			return nil, err
+		}
+		g.f = newInflater(br, cp.window, cp.out)
+	}
+	g.f.onBlock = func(in int64, out int64, window []byte) {
+		add(decompressCheckpoint{out: out, in: in, window: window})
+	}
+	return g, nil
+}
+
+const (
+	zstdMagic          = 0xfd2fb528
+	zstdSkippableMagic = 0x184d2a50 // the lowest 4 bits are any
+)
+
+// zstdFrameSize returns size of the frame at given position of compressed data
+// and whether it is a skippable one
+func zstdFrameSize(ra io.ReaderAt, off int64) (int64, bool, error) {
+	var b [14]byte
+	n, err := ra.ReadAt(b[:], off)
+	if n == 0 && err == io.EOF {
+		return 0, false, io.EOF
+	}
+	if n < 8 {
+		return 0, false, io.ErrUnexpectedEOF
+	}
+	magic := binary.LittleEndian.Uint32(b[:])
+	if magic&^0xf == zstdSkippableMagic {
+		return 8 + int64(binary.LittleEndian.Uint32(b[4:])), true, nil
+	}
+	if magic != zstdMagic {
+		return 0, false, errors.New("invalid frame")
+	}
+
+	descriptor := b[4]
+	size := int64(5)
+	singleSegment := descriptor&0x20 != 0
+	if !singleSegment {
+		size++
+	}
+	size += []int64{0, 1, 2, 4}[descriptor&3]
+	switch fcs := descriptor >> 6; {
+	case fcs == 0 && singleSegment:
+		size++
+	case fcs != 0:
+		size += 1 << fcs
+	}
+	for {
+		var header [3]byte
+		if _, err := ra.ReadAt(header[:], off+size); err != nil {
+			return 0, false, io.ErrUnexpectedEOF
+		}
+		h := int64(header[0]) | int64(header[1])<<8 | int64(header[2])<<16
+		blockSize := h >> 3
+		if (h>>1)&3 == 1 {
+			blockSize = 1
+		}
+		size += 3 + blockSize
+		if h&1 == 1 {
+			break
+		}
+	}
+	if descriptor&0x04 != 0 {
+		size += 4
+	}
+	return size, false, nil
+}
+
+// zstdFrames decompresses frames of a zstd file one by one. Each frame can be
+// decompressed on its own, so starts of frames are checkpoints
+type zstdFrames struct {
+	ra    io.ReaderAt
+	dec   *zstd.Decoder
+	in    int64 // position of the next frame in compressed data
+	out   int64 // position in decompressed data
+	frame bool  // dec reads a frame
+	add   func(decompressCheckpoint)
+}
+
+func (z *zstdFrames) Read(p []byte) (int, error) {
+	for {
+		if !z.frame {
+			z.add(decompressCheckpoint{out: z.out, in: z.in})
+			size, skippable, err := zstdFrameSize(z.ra, z.in)
+			if err != nil {
+				return 0, err
+			}
+			if !skippable {
+				if err := z.dec.Reset(io.NewSectionReader(z.ra, z.in, size)); err != nil {
+					return 0, err
+				}
+				z.frame = true
+			}
+			z.in += size
+			continue
+		}
+		n, err := z.dec.Read(p)
+		z.out += int64(n)
+		if err == io.EOF {
+			z.frame = false
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func openZstd(ra io.ReaderAt, cp *decompressCheckpoint, add func(decompressCheckpoint)) (io.Reader, error) {
+	// decoding with one goroutine is synchronous, so the decoder needs no Close
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	z := &zstdFrames{}
+	z.ra = ra
+	z.dec = dec
+	z.add = add
+	if cp != nil {
+		z.in = cp.in
+		z.out = cp.out
+	}
+	return z, nil
+}
+
+// bzip2StreamEnd returns position of the start of the stream following the one
+// at given position of compressed data, or the end of the data. Streams start at
+// a byte, unlike blocks of bzip2, so they are the only checkpoints
+func bzip2StreamEnd(ra io.ReaderAt, off int64) (int64, error) {
+	const headerSize = 10 // "BZh", level and magic of a block or the end
+	var b [64 << 10]byte
+	pos := off + 4
+	for {
+		n, err := ra.ReadAt(b[:], pos)
+		for i := 0; i+headerSize <= n; i++ {
+			h := b[i : i+headerSize]
+			if bytes.HasPrefix(h, []byte("BZh")) && h[3] >= '1' && h[3] <= '9' &&
+				(bytes.Equal(h[4:], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) ||
+					bytes.Equal(h[4:], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})) {
+				return pos + int64(i), nil
+			}
+		}
+		if err == io.EOF {
+			return pos + int64(n), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos += Max(int64(n-headerSize+1), 1)
+	}
+}
+
+// bzip2Streams decompresses streams of a bzip2 file one by one, as they are
+// concatenated by parallel compressors. A file of one stream is decompressed
+// from the beginning
+type bzip2Streams struct {
+	ra  io.ReaderAt
+	r   io.Reader // decompressed data of the current stream, nil between streams
+	in  int64     // position of the next stream in compressed data
+	out int64     // position in decompressed data
+	add func(decompressCheckpoint)
+}
+
+func (b *bzip2Streams) Read(p []byte) (int, error) {
+	for {
+		if b.r == nil {
+			var magic [1]byte
+			if n, _ := b.ra.ReadAt(magic[:], b.in); n == 0 {
+				return 0, io.EOF
+			}
+			b.add(decompressCheckpoint{out: b.out, in: b.in})
+			end, err := bzip2StreamEnd(b.ra, b.in)
+			if err != nil {
+				return 0, err
+			}
+			b.r = bzip2.NewReader(bufio.NewReader(io.NewSectionReader(b.ra, b.in, end-b.in)))
+			b.in = end
+		}
+		n, err := b.r.Read(p)
+		b.out += int64(n)
+		if err == io.EOF {
+			b.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func openBzip2(ra io.ReaderAt, cp *decompressCheckpoint, add func(decompressCheckpoint)) (io.Reader, error) {
+	b := &bzip2Streams{}
+	b.ra = ra
+	b.add = add
+	if cp != nil {
+		b.in = cp.in
+		b.out = cp.out
+	}
+	return b, nil
+}
+
+var errXzFilters = errors.New("filters other than LZMA2 are not supported")
+
+// xzInput is compressed data of xz, which counts the bytes read
+type xzInput struct {
+	br  *bufio.Reader
+	pos int64 // position in compressed data
+}
+
+func (in *xzInput) Read(p []byte) (int, error) {
+	n, err := in.br.Read(p)
+	in.pos += int64(n)
+	return n, err
+}
+
+func (in *xzInput) ReadByte() (byte, error) {
+	b, err := in.br.ReadByte()
+	if err == nil {
+		in.pos++
+	}
+	return b, err
+}
+
+// skip reads n bytes, which have to be zero if zeros is true
+func (in *xzInput) skip(n int64, zeros bool) error {
+	for ; n > 0; n-- {
+		b, err := in.ReadByte()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if zeros && b != 0 {
+			return errors.New("invalid padding")
+		}
+	}
+	return nil
+}
+
+// xzBlocks decompresses blocks of xz streams one by one. The blocks filtered
+// only by LZMA2 start with a reset dictionary, so starts of blocks are
+// checkpoints. Files of one block, or filtered also by other filters, are
+// decompressed from the beginning
+type xzBlocks struct {
+	in    *xzInput
+	check byte      // type of checks of blocks of the current stream
+	hash  hash.Hash // check of the current block, nil if it is not verified
+	r     io.Reader // decompressed data of the current block, nil between blocks
+	start int64     // position of the current block in compressed data
+	out   int64     // position in decompressed data
+	add   func(decompressCheckpoint)
+}
+
+// xzCheckSizes are sizes of checks of blocks by their type
+var xzCheckSizes = [16]int64{0, 4, 4, 4, 8, 8, 8, 16, 16, 16, 32, 32, 32, 64, 64, 64}
+
+// readStreamHeader reads the header of a stream, following its first 4 bytes
+func (x *xzBlocks) readStreamHeader() error {
+	var header [8]byte
+	if _, err := io.ReadFull(x.in, header[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(header[:2], []byte{'Z', 0x00}) || header[2] != 0 || header[3] > 0x0f ||
+		crc32.ChecksumIEEE(header[2:4]) != binary.LittleEndian.Uint32(header[4:]) {
+		return errors.New("invalid stream header")
+	}
+	x.check = header[3]
+	return nil
+}
+
+// nextStream skips the index and the footer of a stream, the padding
+// following it and the header of the next stream. It returns io.EOF at the end
+// of the file
+func (x *xzBlocks) nextStream() error {
+	start := x.in.pos - 1
+	records, err := binary.ReadUvarint(x.in)
+	for i := uint64(0); err == nil && i < 2*records; i++ {
+		_, err = binary.ReadUvarint(x.in)
+	}
+	if err != nil {
+		return err
+	}
+	if err := x.in.skip((start-x.in.pos)&3, true); err != nil {
+		return err
+	}
+	var footer [16]byte // CRC32 of the index and the footer
+	if _, err := io.ReadFull(x.in, footer[:]); err != nil {
+		return err
+	}
+	if !bytes.Equal(footer[14:], []byte("YZ")) {
+		return errors.New("invalid stream footer")
+	}
+	for {
+		var magic [4]byte
+		if _, err := io.ReadFull(x.in, magic[:]); err != nil {
+			return err
+		}
+		if bytes.Equal(magic[:], []byte{0xfd, '7', 'z', 'X'}) {
+			return x.readStreamHeader()
+		}
+		if !bytes.Equal(magic[:], []byte{0, 0, 0, 0}) {
+			return errors.New("invalid stream padding")
+		}
+	}
+}
+
+// startBlock reads the header of the next block, or of the block at a
+// checkpoint
+func (x *xzBlocks) startBlock() error {
+	for {
+		x.start = x.in.pos
+		size, err := x.in.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size != 0 {
+			header := make([]byte, (int(size)+1)*4)
+			header[0] = size
+			if _, err := io.ReadFull(x.in, header[1:]); err != nil {
+				return err
+			}
+			return x.openBlock(header)
+		}
+		if err := x.nextStream(); err != nil {
+			return err
+		}
+	}
+}
+
+// openBlock starts decompressing data of a block with given header
+func (x *xzBlocks) openBlock(header []byte) error {
+	n := len(header) - 4
+	if crc32.ChecksumIEEE(header[:n]) != binary.LittleEndian.Uint32(header[n:]) {
+		return errors.New("invalid block header")
+	}
+	flags := header[1]
+	if flags&0x3f != 0 {
+		return errXzFilters
+	}
+	br := bytes.NewReader(header[2:n])
+	if flags&0x40 != 0 {
+		binary.ReadUvarint(br)
+	}
+	if flags&0x80 != 0 {
+		binary.ReadUvarint(br)
+	}
+	id, _ := binary.ReadUvarint(br)
+	propsSize, _ := binary.ReadUvarint(br)
+	props, err := br.ReadByte()
+	if err != nil || id != 0x21 || propsSize != 1 {
+		return errXzFilters
+	}
+	dictCap, err := lzma.DecodeDictCap(props)
+	if err != nil {
+		return err
+	}
+	r, err := lzma.Reader2Config{DictCap: int(dictCap)}.NewReader2(x.in)
+	if err != nil {
+		return err
+	}
+	x.add(decompressCheckpoint{out: x.out, in: x.start, check: x.check})
+	x.r = r
+	x.hash = nil
+	switch x.check {
+	case 0x01:
+		x.hash = crc32.NewIEEE()
+	case 0x04:
+		x.hash = crc64.New(crc64.MakeTable(crc64.ECMA))
+	case 0x0a:
+		x.hash = sha256.New()
+	}
+	if x.hash != nil {
+		x.r = io.TeeReader(r, x.hash)
+	}
+	return nil
+}
+
+// endBlock reads the padding and the check following data of a block
+func (x *xzBlocks) endBlock() error {
+	if err := x.in.skip((x.start-x.in.pos)&3, true); err != nil {
+		return err
+	}
+	check := make([]byte, xzCheckSizes[x.check])
+	if _, err := io.ReadFull(x.in, check); err != nil {
+		return err
+	}
+	if x.hash == nil {
+		return nil
+	}
+	sum := x.hash.Sum(nil)
+	if x.check != 0x0a {
+		// CRCs are stored in little-endian order
+		for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+			sum[i], sum[j] = sum[j], sum[i]
+		}
+	}
+	if !bytes.Equal(check, sum) {
+		return errors.New("checksum mismatch")
+	}
+	return nil
+}
+
+func (x *xzBlocks) Read(p []byte) (int, error) {
+	for {
+		if x.r == nil {
+			if err := x.startBlock(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := x.r.Read(p)
+		x.out += int64(n)
+		if err == io.EOF {
+			x.r = nil
+			err = x.endBlock()
+			if n == 0 && err == nil {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func openXz(ra io.ReaderAt, cp *decompressCheckpoint, add func(decompressCheckpoint)) (io.Reader, error) {
+	x := &xzBlocks{}
+	x.add = add
+	if cp != nil {
+		x.in = &xzInput{br: bufio.NewReader(readerFrom(ra, cp.in)), pos: cp.in}
+		x.check = cp.check
+		x.out = cp.out
+		return x, nil
+	}
+	x.in = &xzInput{br: bufio.NewReader(readerFrom(ra, 0))}
+	if err := x.in.skip(4, false); err != nil {
+		return nil, err
+	}
+	if err := x.readStreamHeader(); err != nil {
+		return nil, err
+	}
+	err := x.startBlock()
+	if err == errXzFilters {
+		return xz.NewReader(bufio.NewReader(readerFrom(ra, 0)))
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return x, nil
+}
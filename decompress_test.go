@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func testLogContents(linesCount int) []byte {
+	var b bytes.Buffer
+	r := rand.New(rand.NewSource(1))
+	levels := []string{"INFO", "WARN", "ERROR", "DEBUG"}
+	for i := 0; i < linesCount; i++ {
+		fmt.Fprintf(&b, "2019-11-25 10:%02d:%02d %v request %v took %vms\n",
+			i/60%60, i%60, levels[r.Intn(len(levels))], r.Int63(), r.Intn(1000))
+	}
+	return b.Bytes()
+}
+
+func gzipped(t *testing.T, level int, members ...[]byte) []byte {
+	var b bytes.Buffer
+	for _, m := range members {
+		w, err := gzip.NewWriterLevel(&b, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Name = "test.log"
+		w.Write(m)
+		w.Close()
+	}
+	return b.Bytes()
+}
+
+func zstdCompressed(t *testing.T, frames ...[]byte) []byte {
+	var b bytes.Buffer
+	for _, f := range frames {
+		w, err := zstd.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f)
+		w.Close()
+		// skippable frames are ignored
+		b.Write([]byte{0x5a, 0x2a, 0x4d, 0x18, 2, 0, 0, 0, 'x', 'y'})
+	}
+	return b.Bytes()
+}
+
+// xzCompressed returns xz streams of blocks of up to blockSize bytes of
+// decompressed data, or of one block if it is 0
+func xzCompressed(t *testing.T, blockSize int64, streams ...[]byte) []byte {
+	var b bytes.Buffer
+	for _, s := range streams {
+		w, err := xz.WriterConfig{BlockSize: blockSize}.NewWriter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(s)
+		w.Close()
+		// padding of streams is ignored
+		b.Write([]byte{0, 0, 0, 0})
+	}
+	return b.Bytes()
+}
+
+// checkReadingAt compares data read at random positions of rs with contents
+func checkReadingAt(t *testing.T, name string, rs io.ReadSeeker, contents []byte) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil || size != int64(len(contents)) {
+		t.Errorf("%v: size want: %v, have: %v %v", name, len(contents), size, err)
+		return
+	}
+	ra := rs.(io.ReaderAt)
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		off := r.Int63n(int64(len(contents)))
+		p := make([]byte, 1+r.Intn(5000))
+		n, err := ra.ReadAt(p, off)
+		expected := contents[off:]
+		if len(expected) > len(p) {
+			expected = expected[:len(p)]
+		}
+		if !bytes.Equal(p[:n], expected) || (n < len(p) && err != io.EOF) {
+			t.Errorf("%v: ReadAt(%v, %v) want: %q, have: %q %v", name, len(p), off, expected, p[:n], err)
+			return
+		}
+	}
+	rs.Seek(0, io.SeekStart)
+	if all, err := ioutil.ReadAll(rs); err != nil || !bytes.Equal(all, contents) {
+		t.Errorf("%v: reading whole data failed: %v", name, err)
+	}
+}
+
+func TestDecompressingFiles(t *testing.T) {
+	defer func(span int64) { decompressSpan = span }(decompressSpan)
+	decompressSpan = 64 << 10
+
+	first := testLogContents(20000)
+	second := testLogContents(3000)
+	whole := append(append([]byte(nil), first...), second...)
+	bzip2Compressed := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x8b, 0x13,
+		0xe1, 0x84, 0x00, 0x00, 0x04, 0xd1, 0x80, 0x00, 0x10, 0x40, 0x00, 0x0f,
+		0x25, 0x9c, 0x00, 0x20, 0x00, 0x21, 0xa1, 0x32, 0x31, 0x94, 0x20, 0x1a,
+		0x00, 0x91, 0x2a, 0x31, 0x95, 0x68, 0xcb, 0x04, 0x82, 0xfd, 0x57, 0xf1,
+		0x77, 0x24, 0x53, 0x85, 0x09, 0x08, 0xb1, 0x3e, 0x18, 0x40}
+
+	testCases := []struct {
+		name        string
+		compressed  []byte
+		contents    []byte
+		checkpoints bool
+	}{
+		{"gzip", gzipped(t, gzip.DefaultCompression, first), first, true},
+		{"gzip members", gzipped(t, gzip.BestSpeed, first, second), whole, true},
+		{"gzip stored", gzipped(t, gzip.NoCompression, first), first, true},
+		{"gzip huffman only", gzipped(t, gzip.HuffmanOnly, first), first, true},
+		{"gzip empty", gzipped(t, gzip.DefaultCompression, nil), nil, false},
+		{"zstd frames", zstdCompressed(t, first, second), whole, true},
+		{"xz", xzCompressed(t, 0, second), second, false},
+		{"xz blocks", xzCompressed(t, 32<<10, first, second), whole, true},
+		{"xz empty", xzCompressed(t, 0, nil), nil, false},
+		{"bzip2", bzip2Compressed, []byte("first line\nsecond line\n"), false},
+		{"bzip2 streams", append(append([]byte(nil), bzip2Compressed...), bzip2Compressed...),
+			[]byte("first line\nsecond line\nfirst line\nsecond line\n"), false},
+	}
+
+	for _, c := range testCases {
+		rs, err := newDecompressedFile(bytes.NewReader(c.compressed))
+		if err != nil {
+			t.Errorf("%v: newDecompressedFile() failed: %v", c.name, err)
+			continue
+		}
+		df, ok := rs.(*decompressedFile)
+		if !ok || df.format.name != c.name[:len(df.format.name)] {
+			t.Errorf("%v: format was not recognized: %T", c.name, rs)
+			continue
+		}
+		if len(c.contents) == 0 {
+			if size, err := rs.Seek(0, io.SeekEnd); size != 0 || err != nil {
+				t.Errorf("%v: size want: 0, have: %v %v", c.name, size, err)
+			}
+			continue
+		}
+		checkReadingAt(t, c.name, rs, c.contents)
+		if hasCheckpoints := len(df.checkpoints) > 1; hasCheckpoints != c.checkpoints {
+			t.Errorf("%v: checkpoints want: %v, have: %v", c.name, c.checkpoints, len(df.checkpoints))
+		}
+	}
+}
+
+func TestGzipCheckpoints(t *testing.T) {
+	defer func(span int64) { decompressSpan = span }(decompressSpan)
+	decompressSpan = 64 << 10
+
+	contents := testLogContents(20000)
+	rs, _ := newDecompressedFile(bytes.NewReader(gzipped(t, gzip.DefaultCompression, contents)))
+	df := rs.(*decompressedFile)
+	rs.Seek(0, io.SeekEnd)
+
+	for n, cp := range df.checkpoints {
+		if n > 0 && cp.out-df.checkpoints[n-1].out < decompressSpan {
+			t.Errorf("Checkpoint %v is too close to the previous one: %v, %v", n, df.checkpoints[n-1].out, cp.out)
+		}
+		window := contents[:cp.out]
+		if len(window) > inflateWindowSize {
+			window = window[len(window)-inflateWindowSize:]
+		}
+		if !bytes.Equal(cp.window, window) {
+			t.Errorf("Checkpoint %v: window does not match data preceding it", n)
+		}
+		r, err := openGzip(df.ra, &df.checkpoints[n], func(decompressCheckpoint) {})
+		if err != nil {
+			t.Errorf("Checkpoint %v: openGzip() failed: %v", n, err)
+			continue
+		}
+		if rest, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(rest, contents[cp.out:]) {
+			t.Errorf("Checkpoint %v: resumed decompression does not match data following it: %v", n, err)
+		}
+	}
+}
+
+func TestResumingAtCheckpoints(t *testing.T) {
+	defer func(span int64) { decompressSpan = span }(decompressSpan)
+	decompressSpan = 1
+
+	contents := testLogContents(3000)
+	bzip2Stream := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x8b, 0x13,
+		0xe1, 0x84, 0x00, 0x00, 0x04, 0xd1, 0x80, 0x00, 0x10, 0x40, 0x00, 0x0f,
+		0x25, 0x9c, 0x00, 0x20, 0x00, 0x21, 0xa1, 0x32, 0x31, 0x94, 0x20, 0x1a,
+		0x00, 0x91, 0x2a, 0x31, 0x95, 0x68, 0xcb, 0x04, 0x82, 0xfd, 0x57, 0xf1,
+		0x77, 0x24, 0x53, 0x85, 0x09, 0x08, 0xb1, 0x3e, 0x18, 0x40}
+	bzip2Contents := []byte("first line\nsecond line\n")
+
+	testCases := []struct {
+		name        string
+		compressed  []byte
+		contents    []byte
+		checkpoints int
+	}{
+		{"xz", xzCompressed(t, 16<<10, contents[:100000], contents[100000:]), contents, 13},
+		{"bzip2", bytes.Repeat(bzip2Stream, 3), bytes.Repeat(bzip2Contents, 3), 3},
+	}
+
+	for _, c := range testCases {
+		rs, _ := newDecompressedFile(bytes.NewReader(c.compressed))
+		df := rs.(*decompressedFile)
+		rs.Seek(0, io.SeekEnd)
+		if len(df.checkpoints) != c.checkpoints {
+			t.Errorf("%v: checkpoints want: %v, have: %v", c.name, c.checkpoints, len(df.checkpoints))
+		}
+		for n, cp := range df.checkpoints {
+			r, err := df.format.open(df.ra, &df.checkpoints[n], func(decompressCheckpoint) {})
+			if err != nil {
+				t.Errorf("%v: checkpoint %v: open() failed: %v", c.name, n, err)
+				continue
+			}
+			if rest, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(rest, c.contents[cp.out:]) {
+				t.Errorf("%v: checkpoint %v: resumed decompression does not match data following it: %v", c.name, n, err)
+			}
+		}
+	}
+}
+
+func TestCorruptXz(t *testing.T) {
+	compressed := xzCompressed(t, 0, testLogContents(100))
+	compressed[len(compressed)-40] ^= 0xff
+	rs, _ := newDecompressedFile(bytes.NewReader(compressed))
+	if _, err := ioutil.ReadAll(rs); err == nil {
+		t.Errorf("reading corrupt data succeeded")
+	}
+}
+
+func TestCorruptGzip(t *testing.T) {
+	compressed := gzipped(t, gzip.DefaultCompression, testLogContents(100))
+	for i := 20; i < 40; i++ {
+		compressed[i] = 0xff
+	}
+	rs, _ := newDecompressedFile(bytes.NewReader(compressed))
+	if _, err := ioutil.ReadAll(rs); err == nil {
+		t.Errorf("reading corrupt data succeeded")
+	}
+}
+
+func TestPlainFileIsNotDecompressed(t *testing.T) {
+	fm := newFileMock("plain text\n")
+	if rs, err := newDecompressedFile(fm); rs != io.ReadSeeker(fm) || err != nil {
+		t.Errorf("newDecompressedFile() want: the same file, have: %T %v", rs, err)
+	}
+}
+
+func TestTextFileOfCompressedFile(t *testing.T) {
+	defer func(span int64) { decompressSpan = span }(decompressSpan)
+	decompressSpan = 64 << 10
+
+	contents := testLogContents(20000)
+	lines := bytes.SplitAfter(contents, []byte("\n"))
+	rs, _ := newDecompressedFile(bytes.NewReader(gzipped(t, gzip.DefaultCompression, contents)))
+	tf := NewTextFile(rs, 5)
+	if _, known := rs.(*decompressedFile).knownSize(); known || tf.sizeKnown {
+		t.Errorf("opening the file decompressed it whole")
+	}
+	for _, lineIndex := range []uint{15000, 14000, 3, 19995, 10} {
+		for n, line := range tf.lines(lineIndex, 5) {
+			if expected := string(bytes.TrimSuffix(lines[lineIndex+uint(n)], []byte("\n"))); line.Contents != expected {
+				t.Errorf("Line %v: want: %q, have: %q", lineIndex+uint(n), expected, line.Contents)
+			}
+		}
+	}
+}
+
+func TestSearchingCompressedFile(t *testing.T) {
+	contents := testLogContents(3000)
+	rs, _ := newDecompressedFile(bytes.NewReader(xzCompressed(t, 0, contents)))
+	tf := NewTextFile(rs, 5)
+	ml := newMatchingLines(tf, substringFilter("10:49:59"))
+	ml.wait()
+	expected := []matchingLine{{2999, int64(bytes.LastIndex(contents, []byte("2019"))), false, false}}
+	if observed := ml.matchesAt(0, 10); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %v, have: %v", expected, observed)
+	}
+
+	if change := tf.update(); change != fileUnchanged || !tf.sizeKnown || tf.size != int64(len(contents)) {
+		t.Errorf("update() want: %v %v, have: %v %v", fileUnchanged, len(contents), change, tf.size)
+	}
+	if lineIndex := tf.lineOfTime(time.Date(2019, 11, 25, 10, 49, 59, 0, time.UTC)); lineIndex != 2999 {
+		t.Errorf("lineOfTime() want: 2999, have: %v", lineIndex)
+	}
+}
+
+// countingReader counts bytes read from the file
+type countingReader struct {
+	*bytes.Reader
+	read int64
+}
+
+func (cr *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.Reader.ReadAt(p, off)
+	atomic.AddInt64(&cr.read, int64(n))
+	return n, err
+}
+
+func TestSearchingCompressedFileSequentially(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+	searchChunkSize = 4096
+
+	compressed := xzCompressed(t, 0, testLogContents(3000))
+	cr := &countingReader{Reader: bytes.NewReader(compressed)}
+	rs, _ := newDecompressedFile(cr)
+	rs.(*decompressedFile).readSize()
+	tf := NewTextFile(rs, 5)
+	atomic.StoreInt64(&cr.read, 0)
+	ml := newMatchingLines(tf, substringFilter("ERROR"))
+	ml.wait()
+	if read := atomic.LoadInt64(&cr.read); read > 2*int64(len(compressed)) {
+		t.Errorf("searching read %v bytes of %v compressed ones", read, len(compressed))
+	}
+}
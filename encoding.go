@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encodingDetectionSize is size of the start of the file used to detect its
+// encoding
+const encodingDetectionSize = 64 * 1024
+
+// textEncoding is a character encoding of a text file. Lines are split on the
+// encoded line ending, contents of lines are decoded into UTF-8, so positions
+// of lines stay positions of their bytes in the file
+type textEncoding struct {
+	name     string
+	aliases  []string
+	bom      []byte            // byte order mark, skipped at the start of the file
+	newline  []byte            // encoded '\n', it starts at a multiple of its length
+	encoding encoding.Encoding // nil for UTF-8
+}
+
+var (
+	utf8Encoding    = &textEncoding{name: "utf-8", aliases: []string{"utf8"}, bom: []byte{0xef, 0xbb, 0xbf}, newline: []byte{'\n'}}
+	utf16LEEncoding = &textEncoding{name: "utf-16le", aliases: []string{"utf16le"}, bom: []byte{0xff, 0xfe}, newline: []byte{'\n', 0},
+		encoding: unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)}
+	utf16BEEncoding = &textEncoding{name: "utf-16be", aliases: []string{"utf16be"}, bom: []byte{0xfe, 0xff}, newline: []byte{0, '\n'},
+		encoding: unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)}
+	windows1252Encoding = &textEncoding{name: "windows-1252", aliases: []string{"cp1252"}, newline: []byte{'\n'},
+		encoding: charmap.Windows1252}
+	latin1Encoding = &textEncoding{name: "latin1", aliases: []string{"iso-8859-1"}, newline: []byte{'\n'},
+		encoding: charmap.ISO8859_1}
+	shiftJISEncoding = &textEncoding{name: "shift-jis", aliases: []string{"shift_jis", "sjis"}, newline: []byte{'\n'},
+		encoding: japanese.ShiftJIS}
+)
+
+// textEncodings are known encodings, the ones with a byte order mark first
+var textEncodings = []*textEncoding{
+	utf8Encoding, utf16LEEncoding, utf16BEEncoding, windows1252Encoding, latin1Encoding, shiftJISEncoding,
+}
+
+// findEncoding returns encoding of given name or one of its aliases
+func findEncoding(name string) (*textEncoding, error) {
+	name = strings.ToLower(name)
+	for _, e := range textEncodings {
+		if e.name == name {
+			return e, nil
+		}
+		for _, alias := range e.aliases {
+			if alias == name {
+				return e, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+// detectEncoding returns encoding of the file starting with head. It is given
+// by a byte order mark or guessed: UTF-16 from zero bytes of ASCII characters,
+// Shift-JIS from pairs of bytes of Japanese characters, Windows-1252 if the
+// text is not valid UTF-8
+func detectEncoding(head []byte) *textEncoding {
+	for _, e := range textEncodings {
+		if len(e.bom) != 0 && bytes.HasPrefix(head, e.bom) {
+			return e
+		}
+	}
+	evenZeros, oddZeros := 0, 0
+	for i, c := range head {
+		if c == 0 && i%2 == 0 {
+			evenZeros++
+		} else if c == 0 {
+			oddZeros++
+		}
+	}
+	units := len(head) / 2
+	switch {
+	case oddZeros > units/4 && evenZeros <= oddZeros/10:
+		return utf16LEEncoding
+	case evenZeros > units/4 && oddZeros <= evenZeros/10:
+		return utf16BEEncoding
+	case validUTF8Head(head):
+		return utf8Encoding
+	case isShiftJIS(head):
+		return shiftJISEncoding
+	}
+	return windows1252Encoding
+}
+
+// validUTF8Head tells if the text is valid UTF-8, except the last character
+// which may be cut off
+func validUTF8Head(head []byte) bool {
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(head)
+}
+
+// isShiftJIS tells if the text is valid Shift-JIS with double byte
+// characters. Windows-1252 text is valid Shift-JIS too, when accented letters
+// are followed by ASCII ones, so most of the characters must have the second
+// byte outside of ASCII
+func isShiftJIS(head []byte) bool {
+	pairs, highTrails := 0, 0
+	for i := 0; i < len(head); i++ {
+		c := head[i]
+		switch {
+		case c < 0x80 || c >= 0xa1 && c <= 0xdf:
+			// ASCII or half-width katakana
+		case c >= 0x81 && c <= 0x9f || c >= 0xe0 && c <= 0xfc:
+			if i+1 == len(head) {
+				break
+			}
+			i++
+			trail := head[i]
+			if trail < 0x40 || trail == 0x7f || trail > 0xfc {
+				return false
+			}
+			pairs++
+			if trail >= 0x80 {
+				highTrails++
+			}
+		default:
+			return false
+		}
+	}
+	return pairs != 0 && highTrails*2 >= pairs
+}
+
+// align returns the first position at or after pos, where a character starts
+func (e *textEncoding) align(pos int64) int64 {
+	unit := int64(len(e.newline))
+	return (pos + unit - 1) / unit * unit
+}
+
+// isLineEnd tells if byte c at position pos of the file ends a line, prev is
+// the byte preceding it
+func (e *textEncoding) isLineEnd(prev byte, c byte, pos int64) bool {
+	if len(e.newline) == 1 {
+		return c == '\n'
+	}
+	return c == e.newline[1] && prev == e.newline[0] && pos%2 == 1
+}
+
+// lineEnds calls found with position following each line ending in b, which
+// was read at position pos of the file. prev is the byte preceding b
+func (e *textEncoding) lineEnds(b []byte, pos int64, prev byte, found func(end int64)) {
+	if len(e.newline) == 1 {
+		for i := 0; ; {
+			n := bytes.IndexByte(b[i:], '\n')
+			if n < 0 {
+				return
+			}
+			i += n + 1
+			found(pos + int64(i))
+		}
+	}
+	for i, c := range b {
+		if e.isLineEnd(prev, c, pos+int64(i)) {
+			found(pos + int64(i) + 1)
+		}
+		prev = c
+	}
+}
+
+// readLine reads bytes of the line starting at the position of the reader,
+// with its line ending. The last line of the file may have no line ending,
+// then it is returned with io.EOF
+func (e *textEncoding) readLine(r *bufio.Reader) ([]byte, error) {
+	if len(e.newline) == 1 {
+		return r.ReadBytes('\n')
+	}
+	var line []byte
+	for {
+		b, err := r.ReadBytes('\n')
+		line = append(line, b...)
+		if err != nil {
+			return line, err
+		}
+		end := len(line) - 1
+		if e.newline[1] == '\n' {
+			// big endian, the line ending is 0 '\n'
+			if end > 0 && e.isLineEnd(line[end-1], '\n', int64(end)) {
+				return line, nil
+			}
+			continue
+		}
+		if end%2 != 0 {
+			continue
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return line, err
+		}
+		line = append(line, c)
+		if c == e.newline[1] {
+			return line, nil
+		}
+	}
+}
+
+// decode returns contents of the line read at given position, without its
+// line ending, in valid UTF-8
+func (e *textEncoding) decode(b []byte, pos int64) string {
+	s := e.text(b, pos)
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "\ufffd")
+	}
+	return s
+}
+
+// decodeLine returns the line read at given position. Invalid bytes of UTF-8
+// files are kept in its raw contents, so they can be shown as escapes
+func (e *textEncoding) decodeLine(b []byte, pos int64, incomplete bool) FileLine {
+	result := FileLine{Contents: e.text(b, pos), position: pos, incomplete: incomplete}
+	if !utf8.ValidString(result.Contents) {
+		result.raw = result.Contents
+		result.Contents = strings.ToValidUTF8(result.raw, "\ufffd")
+	}
+	return result
+}
+
+// text returns text of the line read at given position, without its line
+// ending. It is not valid UTF-8, if the line is not
+func (e *textEncoding) text(b []byte, pos int64) string {
+	if pos == 0 && len(e.bom) != 0 {
+		b = bytes.TrimPrefix(b, e.bom)
+	}
+	b = bytes.TrimSuffix(b, e.newline)
+	if e.encoding != nil {
+		decoded, err := e.encoding.NewDecoder().Bytes(b)
+		if err == nil {
+			b = decoded
+		}
+	}
+	return strings.TrimSuffix(string(b), "\r")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// encodeText returns the text in given encoding, with its byte order mark
+func encodeText(t *testing.T, enc *textEncoding, text string) string {
+	encoded, err := enc.encoding.NewEncoder().String(text)
+	if err != nil {
+		t.Fatalf("encoding %q failed: %v", text, err)
+	}
+	return string(enc.bom) + encoded
+}
+
+func TestDetectingEncoding(t *testing.T) {
+	shiftJIS, _ := japanese.ShiftJIS.NewEncoder().String("ログを読みます\n")
+	testCases := []struct {
+		head     string
+		expected *textEncoding
+	}{
+		{"plain text\n", utf8Encoding},
+		{"\xef\xbb\xbfplain text\n", utf8Encoding},
+		{"h\xc3\xa9llo\n", utf8Encoding},
+		{"h\xc3\xa9llo h\xc3", utf8Encoding},
+		{"\xff\xfep\x00", utf16LEEncoding},
+		{"\xfe\xff\x00p", utf16BEEncoding},
+		{"p\x00l\x00a\x00i\x00n\x00\n\x00", utf16LEEncoding},
+		{"\x00p\x00l\x00a\x00i\x00n\x00\n", utf16BEEncoding},
+		{"caf\xe9 cr\xe8me\n", windows1252Encoding},
+		{shiftJIS, shiftJISEncoding},
+		{"", utf8Encoding},
+	}
+	for n, c := range testCases {
+		if observed := detectEncoding([]byte(c.head)); observed != c.expected {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.expected.name, observed.name)
+		}
+	}
+}
+
+func TestFindingEncoding(t *testing.T) {
+	if enc, err := findEncoding("UTF-16LE"); enc != utf16LEEncoding || err != nil {
+		t.Errorf("findEncoding() want: %v, have: %v %v", utf16LEEncoding.name, enc, err)
+	}
+	if enc, err := findEncoding("cp1252"); enc != windows1252Encoding || err != nil {
+		t.Errorf("findEncoding() want: %v, have: %v %v", windows1252Encoding.name, enc, err)
+	}
+	if _, err := findEncoding("ebcdic"); err == nil {
+		t.Errorf("findEncoding() of unknown encoding succeeded")
+	}
+}
+
+func TestDecodingLines(t *testing.T) {
+	testCases := []struct {
+		enc      *textEncoding
+		line     string
+		pos      int64
+		expected string
+	}{
+		{utf8Encoding, "\xef\xbb\xbfline\r\n", 0, "line"},
+		{utf8Encoding, "\xef\xbb\xbfline\n", 10, "\ufeffline"},
+		{utf8Encoding, "bad \xff\n", 0, "bad \ufffd"},
+		{windows1252Encoding, "caf\xe9\n", 0, "café"},
+		{latin1Encoding, "\xa4\n", 0, "¤"},
+		{windows1252Encoding, "\x80\n", 0, "€"},
+		{utf16LEEncoding, "\xff\xfeo\x00k\x00\r\x00\n\x00", 0, "ok"},
+		{utf16BEEncoding, "\x00o\x00k\x00\n", 4, "ok"},
+	}
+	for n, c := range testCases {
+		if observed := c.enc.decode([]byte(c.line), c.pos); observed != c.expected {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+
+	line := utf8Encoding.decodeLine([]byte("bad \xff\n"), 0, false)
+	if line.Contents != "bad \ufffd" || line.rawContents() != "bad \xff" {
+		t.Errorf("decodeLine() want: %q %q, have: %q %q", "bad \ufffd", "bad \xff", line.Contents, line.rawContents())
+	}
+}
+
+func TestUTF16TextFile(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+
+	// bytes of the characters look like line endings at odd positions
+	lines := []string{"first", "ĀੁĀx", "Ċ", "last"}
+	positions := []int64{0, 14, 24, 28}
+	for _, enc := range []*textEncoding{utf16LEEncoding, utf16BEEncoding} {
+		fm := newFileMock(encodeText(t, enc, strings.Join(lines, "\n")))
+		tf := NewTextFile(fm, 10)
+		if tf.enc != enc {
+			t.Errorf("%v: detected encoding: %v", enc.name, tf.enc.name)
+		}
+		for i, contents := range lines {
+			expected := FileLine{Contents: contents, position: positions[i], incomplete: i == len(lines)-1}
+			if tf.CachedLines[uint(i)] != expected {
+				t.Errorf("%v: line %v want: %v, have: %v", enc.name, i, expected, tf.CachedLines[uint(i)])
+			}
+		}
+
+		if p, err := getLinePosition(fm, enc, 3, 28, -2); p != 14 || err != nil {
+			t.Errorf("%v: getLinePosition() want: 14, have: %v %v", enc.name, p, err)
+		}
+
+		li := newLineIndex(1)
+		li.enc = enc
+		li.build(fm)
+		if !reflect.DeepEqual(li.checkpoints, positions) {
+			t.Errorf("%v: checkpoints want: %v, have: %v", enc.name, positions, li.checkpoints)
+		}
+
+		filter := func(line FileLine) bool { return strings.ContainsAny(line.Contents, "xĊ") }
+		expected := []matchingLine{{1, 14, false, false}, {2, 24, false, false}}
+		for _, chunkSize := range []int64{1, 3, 10, 100} {
+			searchChunkSize = chunkSize
+			var matches []matchingLine
+			nextLine, end, err := searchFile(context.Background(), fm, enc, 0, 0, int64(len(fm.contents)), filter,
+				func(m []matchingLine, searched int64) { matches = append(matches, m...) })
+			if err != nil || !reflect.DeepEqual(matches, expected) || nextLine != 3 || end != 28 {
+				t.Errorf("%v, chunk size %v: want: %v 3 28, have: %v %v %v %v",
+					enc.name, chunkSize, expected, matches, nextLine, end, err)
+			}
+		}
+	}
+}
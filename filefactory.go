@@ -1,6 +1,9 @@
 package main
 
-import "io"
+import (
+	"io"
+	"strings"
+)
 
 func newFileMock(contents string) *fileMock {
 	result := &fileMock{}
@@ -19,3 +22,9 @@ func create10DigitsFile() io.ReadSeeker {
 func createMultiLineFile() io.ReadSeeker {
 	return newFileMock("1\n2\n3\n")
 }
+
+func substringFilter(text string) func(FileLine) bool {
+	return func(line FileLine) bool {
+		return strings.Contains(line.Contents, text)
+	}
+}
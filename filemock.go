@@ -10,6 +10,8 @@ type fileMock struct {
 	io.ReadSeeker
 	contents string
 	position int64
+	err      error // returned by reads, if it is set
+	seeks    int   // number of seeks from the start, i.e. of places read from
 }
 
 func (fm *fileMock) Seek(offset int64, whence int) (int64, error) {
@@ -18,6 +20,7 @@ func (fm *fileMock) Seek(offset int64, whence int) (int64, error) {
 	switch whence {
 	case io.SeekStart:
 		globalPos = offset
+		fm.seeks++
 	case io.SeekEnd:
 		globalPos = int64(len(fm.contents)) + offset
 	case io.SeekCurrent:
@@ -34,6 +37,9 @@ func (fm *fileMock) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (fm *fileMock) Read(p []byte) (n int, err error) {
+	if fm.err != nil {
+		return 0, fm.err
+	}
 	if int(fm.position) >= len(fm.contents) {
 		err = io.EOF
 		return
@@ -47,3 +53,17 @@ func (fm *fileMock) Read(p []byte) (n int, err error) {
 	n = copyingSize
 	return n, err
 }
+
+func (fm *fileMock) ReadAt(p []byte, off int64) (n int, err error) {
+	if fm.err != nil {
+		return 0, fm.err
+	}
+	if off >= int64(len(fm.contents)) {
+		return 0, io.EOF
+	}
+	n = copy(p, fm.contents[off:])
+	if n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter expressions select lines by their text and fields:
+//
+//	timeout                   line contains the word
+//	"connection reset"        line contains the text
+//	"Timeout"i                line contains the text, ignoring case
+//	/time(out)?/              line matches the regexp, /.../i ignores case
+//	level>=WARN               field compared with the value
+//	host:db1                  field contains the value, ignoring case
+//	msg~"timeout"             field matches the regexp, !~ does not
+//	not a, a and b, a or b    negation, conjunction and alternative
+//	a b                       same as a and b
+//
+// Fields can be compared with =, !=, <, <=, > and >=. Values which are log
+// levels or numbers are compared as such, others as text.
+
+// fieldGetter returns value of a field of the line
+type fieldGetter func(line FileLine, name string) (string, bool)
+
+// filterError is returned for invalid filter expressions
+type filterError struct {
+	column int
+	msg    string
+}
+
+func (e *filterError) Error() string {
+	return fmt.Sprintf("column %v: %v", e.column, e.msg)
+}
+
+type filterTokenKind int
+
+const (
+	tokenEnd filterTokenKind = iota
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenText   // word or quoted text
+	tokenRegexp // regexp between slashes
+	tokenField  // field name followed by comparison operator
+)
+
+type filterToken struct {
+	kind   filterTokenKind
+	text   string // text, pattern or field name
+	op     string // comparison operator of the field
+	icase  bool   // text or regexp ignores case
+	column int
+}
+
+var fieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*(!=|!~|<=|>=|:|=|~|<|>)`)
+
+func isWordEnd(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// hasValueAt tells if a field value starts at given position. Otherwise, e.g.
+// for "ERROR:", the word is not taken for a field
+func hasValueAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return i < len(text) && !isWordEnd(r)
+}
+
+// lexFilter splits the expression into tokens
+func lexFilter(text string) ([]filterToken, error) {
+	var result []filterToken
+	i := 0
+	column := func() int {
+		return utf8.RuneCountInString(text[:i]) + 1
+	}
+	// caseFlag consumes "i" flag following quoted text or regexp
+	caseFlag := func() bool {
+		if strings.HasPrefix(text[i:], "i") {
+			next, _ := utf8.DecodeRuneInString(text[i+1:])
+			if i+1 == len(text) || isWordEnd(next) {
+				i++
+				return true
+			}
+		}
+		return false
+	}
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		token := filterToken{column: column()}
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '(':
+			token.kind = tokenLParen
+			i++
+		case r == ')':
+			token.kind = tokenRParen
+			i++
+		case strings.HasPrefix(text[i:], "&&"):
+			token.kind = tokenAnd
+			i += 2
+		case strings.HasPrefix(text[i:], "||"):
+			token.kind = tokenOr
+			i += 2
+		case r == '!':
+			token.kind = tokenNot
+			i++
+		case r == '"' || r == '\'' || r == '/':
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(text) {
+				c := text[i]
+				if c == '\\' && i+1 < len(text) {
+					next := text[i+1]
+					// escapes other than the delimiter are left for the regexp
+					if r == '/' && next != '/' {
+						sb.WriteByte(c)
+					}
+					sb.WriteByte(next)
+					i += 2
+					continue
+				}
+				i++
+				if rune(c) == r {
+					closed = true
+					break
+				}
+				sb.WriteByte(c)
+			}
+			if !closed {
+				return nil, &filterError{token.column, fmt.Sprintf("missing closing %c", r)}
+			}
+			token.kind = tokenText
+			if r == '/' {
+				token.kind = tokenRegexp
+			}
+			token.text = sb.String()
+			token.icase = caseFlag()
+		default:
+			if m := fieldPattern.FindStringSubmatch(text[i:]); m != nil && hasValueAt(text, i+len(m[0])) {
+				token.kind = tokenField
+				token.op = m[1]
+				token.text = m[0][:len(m[0])-len(m[1])]
+				i += len(m[0])
+				break
+			}
+			start := i
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if isWordEnd(r) {
+					break
+				}
+				i += size
+			}
+			token.text = text[start:i]
+			switch strings.ToLower(token.text) {
+			case "and":
+				token.kind = tokenAnd
+			case "or":
+				token.kind = tokenOr
+			case "not":
+				token.kind = tokenNot
+			default:
+				token.kind = tokenText
+			}
+		}
+		result = append(result, token)
+	}
+	return append(result, filterToken{kind: tokenEnd, column: column()}), nil
+}
+
+type filterNode interface {
+	matches(line FileLine) bool
+}
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ node filterNode }
+
+type textNode struct {
+	text  string
+	icase bool
+}
+
+type regexpNode struct{ re *regexp.Regexp }
+
+type fieldNode struct {
+	name   string
+	op     string
+	value  string
+	re     *regexp.Regexp // for ~ and !~
+	fields fieldGetter
+}
+
+func (n andNode) matches(line FileLine) bool { return n.left.matches(line) && n.right.matches(line) }
+func (n orNode) matches(line FileLine) bool  { return n.left.matches(line) || n.right.matches(line) }
+func (n notNode) matches(line FileLine) bool { return !n.node.matches(line) }
+
+func (n textNode) matches(line FileLine) bool {
+	if n.icase {
+		return strings.Contains(strings.ToLower(line.Contents), n.text)
+	}
+	return strings.Contains(line.Contents, n.text)
+}
+
+func (n regexpNode) matches(line FileLine) bool {
+	return n.re.MatchString(line.Contents)
+}
+
+func (n fieldNode) matches(line FileLine) bool {
+	v, ok := n.fields(line, n.name)
+	if !ok {
+		return n.op == "!=" || n.op == "!~"
+	}
+	switch n.op {
+	case ":":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(n.value))
+	case "~":
+		return n.re.MatchString(v)
+	case "!~":
+		return !n.re.MatchString(v)
+	}
+	c := compareFieldValues(v, n.value)
+	switch n.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// compareFieldValues compares values as log levels or numbers, if both are
+// ones, otherwise as text
+func compareFieldValues(a string, b string) int {
+	if la, ok := parseLogLevel(a); ok {
+		if lb, ok := parseLogLevel(b); ok {
+			return int(la) - int(lb)
+		}
+	}
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	fields fieldGetter
+}
+
+func (fp *filterParser) peek() filterToken {
+	return fp.tokens[fp.pos]
+}
+
+func (fp *filterParser) next() filterToken {
+	t := fp.tokens[fp.pos]
+	if t.kind != tokenEnd {
+		fp.pos++
+	}
+	return t
+}
+
+func (fp *filterParser) parseOr() (filterNode, error) {
+	left, err := fp.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for fp.peek().kind == tokenOr {
+		fp.next()
+		right, err := fp.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (fp *filterParser) parseAnd() (filterNode, error) {
+	left, err := fp.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch fp.peek().kind {
+		case tokenAnd:
+			fp.next()
+		case tokenNot, tokenLParen, tokenText, tokenRegexp, tokenField:
+			// terms without operator between them must all match
+		default:
+			return left, nil
+		}
+		right, err := fp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+}
+
+func (fp *filterParser) parseUnary() (filterNode, error) {
+	if fp.peek().kind == tokenNot {
+		fp.next()
+		node, err := fp.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+	return fp.parsePrimary()
+}
+
+func compileRegexp(t filterToken) (*regexp.Regexp, error) {
+	pattern := t.text
+	if t.icase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &filterError{t.column, err.Error()}
+	}
+	return re, nil
+}
+
+func (fp *filterParser) parsePrimary() (filterNode, error) {
+	t := fp.next()
+	switch t.kind {
+	case tokenLParen:
+		node, err := fp.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := fp.next(); closing.kind != tokenRParen {
+			return nil, &filterError{closing.column, "missing )"}
+		}
+		return node, nil
+	case tokenText:
+		if t.icase {
+			return textNode{strings.ToLower(t.text), true}, nil
+		}
+		return textNode{t.text, false}, nil
+	case tokenRegexp:
+		re, err := compileRegexp(t)
+		if err != nil {
+			return nil, err
+		}
+		return regexpNode{re}, nil
+	case tokenField:
+		return fp.parseField(t)
+	case tokenEnd:
+		return nil, &filterError{t.column, "unexpected end of expression"}
+	}
+	return nil, &filterError{t.column, "unexpected token"}
+}
+
+func (fp *filterParser) parseField(field filterToken) (filterNode, error) {
+	value := fp.next()
+	if value.kind != tokenText && value.kind != tokenRegexp {
+		return nil, &filterError{value.column, "value of " + field.text + " expected"}
+	}
+	node := fieldNode{name: field.text, op: field.op, value: value.text, fields: fp.fields}
+	switch {
+	case field.op == "~" || field.op == "!~":
+		re, err := compileRegexp(value)
+		if err != nil {
+			return nil, err
+		}
+		node.re = re
+	case value.kind == tokenRegexp:
+		return nil, &filterError{value.column, "regexp can be compared only with ~ or !~"}
+	}
+	return node, nil
+}
+
+// newFilter parses the expression into a predicate. Fields of lines are
+// read with given fieldGetter
+func newFilter(expression string, fields fieldGetter) (func(FileLine) bool, error) {
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	fp := &filterParser{tokens: tokens, fields: fields}
+	node, err := fp.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := fp.peek(); t.kind != tokenEnd {
+		return nil, &filterError{t.column, "unexpected token"}
+	}
+	return node.matches, nil
+}
+
+// plainTextField returns field of a plain text line. Fields are key=value
+// words of the line, level is the first upper case word naming a log level,
+// msg and line are the whole line
+func plainTextField(line FileLine, name string) (string, bool) {
+	if name == "line" {
+		return line.Contents, true
+	}
+	for _, word := range strings.Fields(line.Contents) {
+		if kv := strings.SplitN(word, "=", 2); len(kv) == 2 && kv[0] == name {
+			return strings.Trim(kv[1], `"`), true
+		}
+	}
+	switch name {
+	case "level":
+		if l := detectLevel(line.Contents); l != levelUnknown {
+			return l.String(), true
+		}
+	case "msg", "message":
+		return line.Contents, true
+	}
+	return "", false
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFilterExpressions(t *testing.T) {
+	lines := []string{
+		"2019-11-25 10:00:00 INFO host=db1 started",
+		"2019-11-25 10:00:01 WARN host=db2 connection Timeout dur=120",
+		"2019-11-25 10:00:02 ERROR host=web1 request timeout dur=35",
+		"2019-11-25 10:00:03 DEBUG no error here",
+	}
+	testCases := []struct {
+		expression string
+		expected   []bool
+	}{
+		{"timeout", []bool{false, false, true, false}},
+		{`"Timeout"i`, []bool{false, true, true, false}},
+		{"'request timeout'", []bool{false, false, true, false}},
+		{`/time(out)?/`, []bool{false, false, true, false}},
+		{`/TIMEOUT/i`, []bool{false, true, true, false}},
+		{"not timeout", []bool{true, true, false, true}},
+		{"!timeout", []bool{true, true, false, true}},
+		{"host db2", []bool{false, true, false, false}},
+		{"db1 or web1", []bool{true, false, true, false}},
+		{"db1 || web1 && timeout", []bool{true, false, true, false}},
+		{"(db1 or db2) and not started", []bool{false, true, false, false}},
+		{"level>=WARN", []bool{false, true, true, false}},
+		{"level<warning", []bool{true, false, false, true}},
+		{"level=ERR", []bool{false, false, true, false}},
+		{"host:DB", []bool{true, true, false, false}},
+		{"host=db1", []bool{true, false, false, false}},
+		{"host!=db1", []bool{false, true, true, true}},
+		{"dur>100", []bool{false, true, false, false}},
+		{"dur<=35", []bool{false, false, true, false}},
+		{`msg~"time(out)?"`, []bool{false, false, true, false}},
+		{`msg~/timeout/i`, []bool{false, true, true, false}},
+		{`host!~^db`, []bool{false, false, true, true}},
+		{`level>=WARN and msg~"timeout" and not host:db1`, []bool{false, false, true, false}},
+		{"INFO:", []bool{false, false, false, false}},
+	}
+
+	for n, c := range testCases {
+		filter, err := newFilter(c.expression, plainTextField)
+		if err != nil {
+			t.Errorf("Case %v: newFilter(%q) failed: %v", n, c.expression, err)
+			continue
+		}
+		for i, l := range lines {
+			if observed := filter(FileLine{Contents: l}); observed != c.expected[i] {
+				t.Errorf("Case %v: %q on line %v. want: %v, have: %v", n, c.expression, i, c.expected[i], observed)
+			}
+		}
+	}
+}
+
+func TestInvalidFilterExpressions(t *testing.T) {
+	testCases := []struct {
+		expression     string
+		expectedColumn int
+	}{
+		{"", 1},
+		{"(a or b", 8},
+		{"a or", 5},
+		{"a )", 3},
+		{`"unclosed`, 1},
+		{"a and /x(/", 7},
+		{"level>=/WARN/", 8},
+		{"level>=(", 9},
+		{"zażółć )", 8},
+		{"not", 4},
+	}
+
+	for n, c := range testCases {
+		_, err := newFilter(c.expression, plainTextField)
+		fe, ok := err.(*filterError)
+		if !ok {
+			t.Errorf("Case %v: newFilter(%q) error want: column %v, have: %v", n, c.expression, c.expectedColumn, err)
+			continue
+		}
+		if fe.column != c.expectedColumn {
+			t.Errorf("Case %v: newFilter(%q) error column want: %v, have: %v (%v)", n, c.expression, c.expectedColumn, fe.column, fe)
+		}
+	}
+}
@@ -6,59 +6,176 @@ import (
 	"strings"
 )
 
+// filteredLine is position of a line kept by filteredFile. Context lines are
+// kept only because they are near a line passing the filter
+type filteredLine struct {
+	position  int64
+	isContext bool
+}
+
+// filteredFile keeps in Lines positions of up to cacheSize lines passing the
+// filter, optionally with lines around them. It filters lines of the file, or
+// lines passing another filteredFile, its input, when it is a layer of a
+// filterStack
 type filteredFile struct {
-	Lines          map[ /*lineIndex*/ uint] /*position in file*/ int64
+	Lines          map[ /*lineIndex*/ uint]filteredLine
 	filter         func(FileLine) bool
 	firstLineIndex uint
 	cacheSize      uint
 	tf             *TextFile
+	input          *filteredFile // nil if all lines of the file are filtered
+	matches        matchSource   // lines or records passing the filter and the input, nil if not filtered
+	src            matchSource   // matches, optionally with context
+	before         uint
+	after          uint
+	recordStart    func(FileLine) bool // nil if lines are filtered one by one
+	expression     string              // expression of the filter shown in breadcrumbs
+	enabled        bool                // a disabled layer of a filterStack is skipped
 }
 
 func newFilteredFile(rs io.ReadSeeker, cacheSize uint, filter func(line FileLine) bool) *filteredFile {
-	result := &filteredFile{}
-	result.firstLineIndex = 0
+	result := newFilterLayer(NewTextFile(rs, 1), "", filter)
 	result.cacheSize = cacheSize
-	result.filter = filter
-	result.tf = NewTextFile(rs, 1)
+	result.filterLines()
 	result.goTo(0)
 	return result
 }
 
-func (ff *filteredFile) goTo(firstLine uint) {
-	ff.Lines = make(map[uint]int64)
-	ff.tf.goTo(firstLine)
-
-	keepFiltering := true
-	checkingLine := firstLine
-	for keepFiltering {
-		var i uint = 0
-		for ; i != ff.tf.cacheSize; i++ {
-			if _, ok := ff.tf.CachedLines[checkingLine]; ok {
-				line, _ := ff.tf.CachedLines[checkingLine]
-				if ff.filter(line) {
-					ff.Lines[checkingLine] = line.position
-				}
-			}
-
-			checkingLine++
-
-			if uint(len(ff.Lines)) >= ff.cacheSize {
-				keepFiltering = false
-				break
-			}
-		}
+// newFilterLayer returns filteredFile of lines of the file, which does not
+// filter them until filterLines is called. Lines are not kept, until goTo is
+// called, so a layer of filterStack does not wait for the search
+func newFilterLayer(tf *TextFile, expression string, filter func(line FileLine) bool) *filteredFile {
+	result := &filteredFile{}
+	result.tf = tf
+	result.expression = expression
+	result.filter = filter
+	result.enabled = true
+	return result
+}
+
+// filterLines starts filtering lines passing the input, or all lines of the
+// file if it is nil
+func (ff *filteredFile) filterLines() {
+	ff.stop()
+	var input matchSource = ff.tf
+	if ff.input != nil {
+		input = ff.input.matches
+	}
+	switch {
+	case ff.recordStart != nil:
+		ff.matches = newRecordLines(ff.tf, input, ff.recordStart, ff.filter)
+	case ff.input != nil:
+		ff.matches = newNarrowedLines(ff.tf, input, ff.filter)
+	default:
+		ff.matches = newMatchingLines(ff.tf, ff.filter)
+	}
+	ff.showContext()
+}
+
+// showContext adds lines around the matches, if they are wanted
+func (ff *filteredFile) showContext() {
+	ff.src = ff.matches
+	if ff.matches != nil && (ff.before != 0 || ff.after != 0) {
+		ff.src = newContextLines(ff.tf, ff.matches, ff.before, ff.after)
+	}
+}
 
-		ff.tf.goTo(checkingLine)
-		if len(ff.tf.CachedLines) == 0 {
-			keepFiltering = false
+// stop cancels searching the file and drops the matches
+func (ff *filteredFile) stop() {
+	if ml, ok := ff.matches.(*matchingLines); ok {
+		ml.stop()
+	}
+	ff.matches = nil
+	ff.src = nil
+}
+
+// refresh keeps lines again after a change, if they were kept by goTo
+func (ff *filteredFile) refresh(firstLine uint) {
+	if ff.Lines != nil {
+		ff.goTo(firstLine)
+	}
+}
+
+// setContext keeps also up to before lines preceding and after lines
+// following each line passing the filter
+func (ff *filteredFile) setContext(before uint, after uint) {
+	ff.before = before
+	ff.after = after
+	ff.showContext()
+	ff.refresh(ff.firstLineIndex)
+}
+
+// setRecords keeps lines of whole records passing the filter, instead of
+// single lines. Records start with lines for which start returns true
+func (ff *filteredFile) setRecords(start func(FileLine) bool) {
+	ff.recordStart = start
+	ff.filterLines()
+	ff.refresh(ff.firstLineIndex)
+}
+
+// goTo keeps lines passing the filter, starting at firstLine. It waits until
+// the file is searched. It returns errLineOutOfRange if no such lines are
+// kept, errFileRotated if the file got smaller since it was checked by update
+// and an error wrapping errIO if searching or reading the file failed
+func (ff *filteredFile) goTo(firstLine uint) error {
+	ff.wait()
+	ff.firstLineIndex = firstLine
+	ff.Lines = make(map[uint]filteredLine)
+	if err := ff.tf.checkRotated(); err != nil {
+		return err
+	}
+	row := ff.src.rowOfLine(firstLine)
+	for _, m := range ff.src.matchesAt(row, ff.cacheSize) {
+		ff.Lines[m.index] = filteredLine{m.position, m.isContext}
+	}
+	if err := ff.lastError(); err != nil {
+		return err
+	}
+	if len(ff.Lines) == 0 {
+		return errLineOutOfRange
+	}
+	return nil
+}
+
+// update re-evaluates the filter on lines appended to the file. If the file was
+// truncated or replaced, positions of lines are invalid, so filtering starts
+// again from the first line
+func (ff *filteredFile) update() fileChange {
+	change := ff.src.update()
+	switch change {
+	case fileGrew:
+		ff.refresh(ff.firstLineIndex)
+	case fileTruncated, fileRotated:
+		ff.refresh(0)
+	}
+	return change
+}
+
+// wait blocks until the running search ends
+func (ff *filteredFile) wait() {
+	if s, ok := ff.src.(searching); ok {
+		s.wait()
+	}
+}
+
+// lastError returns error of searching or reading the file by this layer or
+// the layers below it
+func (ff *filteredFile) lastError() error {
+	if f, ok := ff.matches.(failing); ok {
+		if err := f.lastError(); err != nil {
+			return err
 		}
 	}
+	if ff.input != nil {
+		return ff.input.lastError()
+	}
+	return nil
 }
 
 func (ff filteredFile) String() string {
 	var sb strings.Builder
 	for n, l := range ff.Lines {
-		sb.WriteString(fmt.Sprintln("l:", n, "p:", l))
+		sb.WriteString(fmt.Sprintln("l:", n, "p:", l.position, "c:", l.isContext))
 	}
 	return sb.String()
 }
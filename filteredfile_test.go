@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"reflect"
 	"strings"
@@ -9,7 +10,7 @@ import (
 
 type FilteredLineTestCase struct {
 	searchString string
-	Lines        map[uint]int64
+	Lines        map[uint]filteredLine
 	firstLine    uint
 	cacheSize    uint
 }
@@ -33,19 +34,19 @@ func TestFilteringSingleLineFile(t *testing.T) {
 			searchString: "bas",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines: map[uint]int64{
-				0: 0}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "base",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines: map[uint]int64{
-				0: 0}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "ba1e",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines:        map[uint]filteredLine{}},
 	}
 	performFilteredFileTests(t, testCases, f)
 }
@@ -57,17 +58,19 @@ func TestFilteringUnfinishedLineFile(t *testing.T) {
 			searchString: "bas",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "base",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "ba1e",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines:        map[uint]filteredLine{}},
 	}
 	performFilteredFileTests(t, testCases, f)
 }
@@ -79,36 +82,36 @@ func TestFilteringMultilineFile(t *testing.T) {
 			searchString: "text",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines: map[uint]int64{
-				0: 0}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "text",
 			firstLine:    0,
 			cacheSize:    2,
-			Lines: map[uint]int64{
-				0: 0,
-				2: 18}},
+			Lines: map[uint]filteredLine{
+				0: {0, false},
+				2: {18, false}}},
 		{
 			searchString: "e",
 			firstLine:    0,
 			cacheSize:    4,
-			Lines: map[uint]int64{
-				0: 0,
-				1: 5,
-				2: 18,
-				3: 30}},
+			Lines: map[uint]filteredLine{
+				0: {0, false},
+				1: {5, false},
+				2: {18, false},
+				3: {30, false}}},
 		{
 			searchString: "e",
 			firstLine:    2,
 			cacheSize:    4,
-			Lines: map[uint]int64{
-				2: 18,
-				3: 30}},
+			Lines: map[uint]filteredLine{
+				2: {18, false},
+				3: {30, false}}},
 		{
 			searchString: "Text",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines:        map[uint]filteredLine{}},
 	}
 	performFilteredFileTests(t, testCases, f)
 }
@@ -120,31 +123,224 @@ func TestFilteringMultilineFileWithUnfinishedLastLine(t *testing.T) {
 			searchString: "complete",
 			firstLine:    0,
 			cacheSize:    1,
-			Lines: map[uint]int64{
-				0: 0}},
+			Lines: map[uint]filteredLine{
+				0: {0, false}}},
 		{
 			searchString: "complete",
 			firstLine:    1,
 			cacheSize:    1,
-			Lines: map[uint]int64{
-				1: 9}},
+			Lines: map[uint]filteredLine{
+				1: {9, false}}},
 		{
 			searchString: "complete",
 			firstLine:    0,
 			cacheSize:    2,
-			Lines: map[uint]int64{
-				0: 0,
-				1: 9}},
+			Lines: map[uint]filteredLine{
+				0: {0, false},
+				1: {9, false}}},
+		{
+			searchString: "complete",
+			firstLine:    0,
+			cacheSize:    3,
+			Lines: map[uint]filteredLine{
+				0: {0, false},
+				1: {9, false},
+				2: {18, false}}},
 		{
 			searchString: "complete",
 			firstLine:    3,
 			cacheSize:    1,
-			Lines:        map[uint]int64{}},
+			Lines:        map[uint]filteredLine{}},
 		{
 			searchString: "\n",
 			firstLine:    0,
 			cacheSize:    2,
-			Lines:        map[uint]int64{}},
+			Lines:        map[uint]filteredLine{}},
 	}
 	performFilteredFileTests(t, testCases, f)
 }
+
+func TestFilteringGrowingFile(t *testing.T) {
+	fm := newFileMock("match\nother\n")
+	ff := newFilteredFile(fm, 3, func(line FileLine) bool {
+		return strings.Contains(line.Contents, "match")
+	})
+
+	fm.contents += "match"
+	ff.update()
+	expected := map[uint]filteredLine{0: {0, false}, 2: {12, false}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+
+	// unfinished line is kept once, when it is finished
+	fm.contents += "\nother\nmatch\nmatch\n"
+	ff.update()
+	expected = map[uint]filteredLine{0: {0, false}, 2: {12, false}, 4: {24, false}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+}
+
+func TestFilteringTruncatedFile(t *testing.T) {
+	fm := newFileMock("other\nmatch\n")
+	ff := newFilteredFile(fm, 3, func(line FileLine) bool {
+		return strings.Contains(line.Contents, "match")
+	})
+
+	fm.contents = "match\n"
+	if change := ff.update(); change != fileTruncated {
+		t.Errorf("update() of truncated file. want: %v, have: %v", fileTruncated, change)
+	}
+	expected := map[uint]filteredLine{0: {0, false}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+}
+
+func TestFilteringWithContext(t *testing.T) {
+	f := newFileMock("m0\nx1\nx2\nm3\nx4\nx5\nx6\nm7\nm8\nx9\n")
+	testCases := []struct {
+		before    uint
+		after     uint
+		firstLine uint
+		cacheSize uint
+		Lines     map[uint]filteredLine
+	}{
+		{
+			before:    1,
+			after:     1,
+			cacheSize: 10,
+			Lines: map[uint]filteredLine{
+				0: {0, false}, 1: {3, true},
+				2: {6, true}, 3: {9, false}, 4: {12, true},
+				6: {18, true}, 7: {21, false}, 8: {24, false}, 9: {27, true}}},
+		{
+			after:     2,
+			cacheSize: 10,
+			Lines: map[uint]filteredLine{
+				0: {0, false}, 1: {3, true}, 2: {6, true},
+				3: {9, false}, 4: {12, true}, 5: {15, true},
+				7: {21, false}, 8: {24, false}, 9: {27, true}}},
+		{
+			before:    3,
+			firstLine: 4,
+			cacheSize: 3,
+			Lines: map[uint]filteredLine{
+				4: {12, true}, 5: {15, true}, 6: {18, true}}},
+		{
+			before:    1,
+			after:     1,
+			firstLine: 5,
+			cacheSize: 2,
+			Lines: map[uint]filteredLine{
+				6: {18, true}, 7: {21, false}}},
+	}
+
+	for n, c := range testCases {
+		ff := newFilteredFile(f, c.cacheSize, substringFilter("m"))
+		ff.goTo(c.firstLine)
+		ff.setContext(c.before, c.after)
+		if !reflect.DeepEqual(c.Lines, ff.Lines) {
+			t.Errorf("Case %v: expect: %v have: %v", n, c.Lines, ff.Lines)
+		}
+	}
+}
+
+func TestFilteringWithOverlappingContext(t *testing.T) {
+	// m2 is in context of m0, x3 and x4 are in context of both m2 and m5
+	ff := newFilteredFile(newFileMock("m0\nx1\nm2\nx3\nx4\nm5\nx6\n"), 10, substringFilter("m"))
+	ff.setContext(2, 2)
+	expected := map[uint]filteredLine{
+		0: {0, false}, 1: {3, true}, 2: {6, false}, 3: {9, true},
+		4: {12, true}, 5: {15, false}, 6: {18, true}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+}
+
+func TestReadingContextAtOnce(t *testing.T) {
+	var contents strings.Builder
+	for i := 0; i != 60; i++ {
+		if i%20 == 10 {
+			contents.WriteString("m\n")
+		} else {
+			contents.WriteString("x\n")
+		}
+	}
+	fm := newFileMock(contents.String())
+	fs := newFilterStack(NewTextFile(fm, 10), plainTextField)
+	fs.push("m")
+	fs.setContext(2, 3)
+	src := fs.source().(matchSource)
+	src.(searching).wait()
+
+	fm.seeks = 0
+	if rows := src.matchesAt(0, 100); len(rows) != 18 {
+		t.Errorf("number of rows want: 18, have: %v", len(rows))
+	}
+	if fm.seeks != 3 {
+		t.Errorf("lines around 3 matches were read from %v places", fm.seeks)
+	}
+}
+
+func TestFilteringGrowingFileWithContext(t *testing.T) {
+	fm := newFileMock("x0\nm1\n")
+	ff := newFilteredFile(fm, 5, substringFilter("m"))
+	ff.setContext(1, 2)
+	expected := map[uint]filteredLine{0: {0, true}, 1: {3, false}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+
+	fm.contents += "x2\n"
+	ff.update()
+	fm.contents += "x3\nx4\n"
+	ff.update()
+	expected = map[uint]filteredLine{0: {0, true}, 1: {3, false}, 2: {6, true}, 3: {9, true}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("expect: %v have: %v", expected, ff.Lines)
+	}
+}
+
+func TestFilteringFailingFile(t *testing.T) {
+	fm := newFileMock("match\nother\n")
+	ff := newFilteredFile(fm, 3, func(line FileLine) bool {
+		return strings.Contains(line.Contents, "match")
+	})
+	if err := ff.goTo(0); err != nil {
+		t.Errorf("goTo() want: no error, have: %v", err)
+	}
+
+	fm.err = errors.New("input/output error")
+	fm.contents += "match\n"
+	ff.update()
+	if err := ff.goTo(0); !errors.Is(err, errIO) {
+		t.Errorf("goTo() of failing file. want: %v, have: %v", errIO, err)
+	}
+}
+
+func TestGoingToFilteredLinesOutOfRange(t *testing.T) {
+	fm := newFileMock("match\nother\n")
+	ff := newFilteredFile(fm, 3, substringFilter("match"))
+	if err := ff.goTo(0); err != nil {
+		t.Errorf("goTo(0) want: no error, have: %v", err)
+	}
+	if err := ff.goTo(1); err != errLineOutOfRange {
+		t.Errorf("goTo(1) want: %v, have: %v", errLineOutOfRange, err)
+	}
+}
+
+func TestGoingToFilteredLinesOfTruncatedFile(t *testing.T) {
+	fm := newFileMock("other\nmatch\n")
+	ff := newFilteredFile(fm, 3, substringFilter("match"))
+	fm.contents = "match\n"
+	if err := ff.goTo(0); err != errFileRotated {
+		t.Errorf("goTo() of truncated file want: %v, have: %v", errFileRotated, err)
+	}
+
+	ff.update()
+	if err := ff.goTo(0); err != nil {
+		t.Errorf("goTo() after update() want: no error, have: %v", err)
+	}
+}
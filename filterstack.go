@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// narrowBatchSize is number of input rows checked at once by narrowedLines
+const narrowBatchSize = 256
+
+// matchSource is an ordered set of lines of the file passing some filter
+type matchSource interface {
+	lineSource
+	countable
+	updatable
+	// matchesAt returns up to count matching lines found so far, starting
+	// at row first
+	matchesAt(first uint, count uint) []matchingLine
+}
+
+// narrowedLines is a matchSource of lines of another matchSource, which pass
+// the filter. Rows of the input are checked lazily, when they are needed
+type narrowedLines struct {
+	tf       *TextFile
+	input    matchSource
+	filter   func(FileLine) bool
+	matches  []matchingLine
+	consumed uint // number of input rows already checked
+}
+
+func newNarrowedLines(tf *TextFile, input matchSource, filter func(FileLine) bool) *narrowedLines {
+	result := &narrowedLines{}
+	result.tf = tf
+	result.input = input
+	result.filter = filter
+	return result
+}
+
+// checkMore checks next batch of input rows, read at once. It returns false if
+// there is nothing more to check at the moment
+func (nl *narrowedLines) checkMore() bool {
+	batch := completeMatches(nl.input.matchesAt(nl.consumed, narrowBatchSize))
+	for n, line := range nl.tf.linesAt(batch) {
+		if nl.filter(line) {
+			nl.matches = append(nl.matches, batch[n])
+		}
+	}
+	nl.consumed += uint(len(batch))
+	return len(batch) != 0
+}
+
+func (nl *narrowedLines) matchesAt(first uint, count uint) []matchingLine {
+	for uint(len(nl.matches)) < first+count && nl.checkMore() {
+	}
+	var result []matchingLine
+	for row := first; row < first+count && row < uint(len(nl.matches)); row++ {
+		result = append(result, nl.matches[row])
+	}
+	return result
+}
+
+func (nl *narrowedLines) lines(first uint, count uint) []FileLine {
+	return nl.tf.linesAt(nl.matchesAt(first, count))
+}
+
+func (nl *narrowedLines) rowOfLine(lineIndex uint) uint {
+	for {
+		row := sort.Search(len(nl.matches), func(i int) bool {
+			return nl.matches[i].index >= lineIndex
+		})
+		if row < len(nl.matches) || !nl.checkMore() {
+			return uint(row)
+		}
+	}
+}
+
+func (nl *narrowedLines) rowsCount() (uint, bool) {
+	count, known := nl.input.rowsCount()
+	if !known || nl.consumed != count {
+		return 0, false
+	}
+	return uint(len(nl.matches)), true
+}
+
+// update passes changes of the input. If the file was truncated or replaced,
+// its rows are checked again
+func (nl *narrowedLines) update() fileChange {
+	change := nl.input.update()
+	if change == fileTruncated || change == fileRotated {
+		nl.matches = nil
+		nl.consumed = 0
+	}
+	return change
+}
+
+func (nl *narrowedLines) progress() (int64, int64, bool) {
+	if s, ok := nl.input.(searching); ok {
+		return s.progress()
+	}
+	return 0, 0, false
+}
+
+func (nl *narrowedLines) wait() {
+	if s, ok := nl.input.(searching); ok {
+		s.wait()
+	}
+}
+
+// filterStack narrows lines of the file step by step, with a filteredFile
+// layer for each filter. Each enabled layer filters lines passing the enabled
+// layer below it, its input. Results of layers are kept, so removing or
+// disabling a layer needs reading only the lines passing the layers below
+type filterStack struct {
+	tf     *TextFile
+	layers []*filteredFile
+	fields fieldGetter
+	before uint // number of context lines shown before matching lines
+	after  uint // number of context lines shown after matching lines
+	// recordStart tells if the line starts a record, filters get whole
+	// records if it is set
+	recordStart func(FileLine) bool
+}
+
+func newFilterStack(tf *TextFile, fields fieldGetter) *filterStack {
+	result := &filterStack{}
+	result.tf = tf
+	result.fields = fields
+	return result
+}
+
+// source returns lines passing all enabled layers, with their context
+func (fs *filterStack) source() lineSource {
+	top := fs.enabledBelow(len(fs.layers))
+	if top == nil {
+		return fs.tf
+	}
+	return top.src
+}
+
+// setContext shows also up to before lines preceding and after lines
+// following each matching line
+func (fs *filterStack) setContext(before uint, after uint) {
+	fs.before = before
+	fs.after = after
+	for _, l := range fs.layers {
+		l.setContext(before, after)
+	}
+}
+
+// setRecords filters whole records starting with lines for which start returns
+// true, instead of single lines. Lines of records passing the filters are shown
+func (fs *filterStack) setRecords(start func(FileLine) bool) {
+	fs.recordStart = start
+	for _, l := range fs.layers {
+		l.recordStart = start
+	}
+	fs.rebuild(0)
+}
+
+// enabledBelow returns the highest enabled layer below given one, nil if there
+// is none
+func (fs *filterStack) enabledBelow(layer int) *filteredFile {
+	for i := layer - 1; i >= 0; i-- {
+		if fs.layers[i].enabled {
+			return fs.layers[i]
+		}
+	}
+	return nil
+}
+
+// filterLayer starts filtering lines passing the layers below given one
+func (fs *filterStack) filterLayer(layer int) {
+	fs.layers[layer].input = fs.enabledBelow(layer)
+	fs.layers[layer].filterLines()
+}
+
+// rebuild filters again layers starting at given one, as their input changed
+func (fs *filterStack) rebuild(from int) {
+	for i := from; i < len(fs.layers); i++ {
+		if fs.layers[i].enabled {
+			fs.filterLayer(i)
+		} else {
+			fs.layers[i].stop()
+		}
+	}
+}
+
+// push adds a layer of the filter expression on top of the stack
+func (fs *filterStack) push(expression string) error {
+	filter, err := newFilter(expression, fs.fields)
+	if err != nil {
+		return err
+	}
+	l := newFilterLayer(fs.tf, expression, filter)
+	l.before = fs.before
+	l.after = fs.after
+	l.recordStart = fs.recordStart
+	fs.layers = append(fs.layers, l)
+	fs.filterLayer(len(fs.layers) - 1)
+	return nil
+}
+
+// pop removes the top layer
+func (fs *filterStack) pop() {
+	if len(fs.layers) == 0 {
+		return
+	}
+	fs.layers[len(fs.layers)-1].stop()
+	fs.layers = fs.layers[:len(fs.layers)-1]
+}
+
+// toggle enables or disables a layer. Results of the layer itself stay valid,
+// only the layers above it are filtered again
+func (fs *filterStack) toggle(layer int) {
+	if layer < 0 || layer >= len(fs.layers) {
+		return
+	}
+	l := fs.layers[layer]
+	l.enabled = !l.enabled
+	if l.enabled && l.matches == nil {
+		fs.filterLayer(layer)
+	}
+	fs.rebuild(layer + 1)
+}
+
+// breadcrumbs describes the layers, disabled ones are in parentheses
+func (fs *filterStack) breadcrumbs() string {
+	var crumbs []string
+	for n, l := range fs.layers {
+		if l.enabled {
+			crumbs = append(crumbs, fmt.Sprintf("%v:%v", n+1, l.expression))
+		} else {
+			crumbs = append(crumbs, fmt.Sprintf("%v:(%v)", n+1, l.expression))
+		}
+	}
+	return strings.Join(crumbs, " > ")
+}
+
+func (fs *filterStack) lines(first uint, count uint) []FileLine {
+	return fs.source().lines(first, count)
+}
+
+// lineOfTime returns index of the first line of the file not before t, the
+// line may be hidden by the filters
+func (fs *filterStack) lineOfTime(t time.Time) uint {
+	return fs.tf.lineOfTime(t)
+}
+
+func (fs *filterStack) rowOfLine(lineIndex uint) uint {
+	return fs.source().rowOfLine(lineIndex)
+}
+
+func (fs *filterStack) rowsCount() (uint, bool) {
+	if c, ok := fs.source().(countable); ok {
+		return c.rowsCount()
+	}
+	return 0, false
+}
+
+// update passes changes of the file to the enabled layers through the top
+// one. Results of disabled layers are dropped, if the file was truncated or
+// replaced
+func (fs *filterStack) update() fileChange {
+	u, ok := fs.source().(updatable)
+	if !ok {
+		return fileUnchanged
+	}
+	change := u.update()
+	if change == fileTruncated || change == fileRotated {
+		for _, l := range fs.layers {
+			if l.enabled {
+				// context of lower layers was not updated
+				l.showContext()
+			} else {
+				l.stop()
+			}
+		}
+	}
+	return change
+}
+
+// lastError returns error of searching or reading the file by any layer
+func (fs *filterStack) lastError() error {
+	for _, l := range fs.layers {
+		if err := l.lastError(); err != nil {
+			return err
+		}
+	}
+	return fs.tf.lastError()
+}
+
+func (fs *filterStack) progress() (int64, int64, bool) {
+	if s, ok := fs.source().(searching); ok {
+		return s.progress()
+	}
+	return 0, 0, false
+}
+
+func (fs *filterStack) wait() {
+	if s, ok := fs.source().(searching); ok {
+		s.wait()
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func stackContents(fs *filterStack) []string {
+	fs.wait()
+	var result []string
+	for _, line := range fs.lines(0, 100) {
+		result = append(result, line.Contents)
+	}
+	return result
+}
+
+func TestFilterStack(t *testing.T) {
+	fm := newFileMock("a1 x\nb2 x\na3 y\nb4 y\na5 x\n")
+	fs := newFilterStack(NewTextFile(fm, 3), plainTextField)
+
+	steps := []struct {
+		action      func() error
+		expected    []string
+		breadcrumbs string
+	}{
+		{
+			action:   func() error { return nil },
+			expected: []string{"a1 x", "b2 x", "a3 y", "b4 y", "a5 x"}},
+		{
+			action:      func() error { return fs.push("x") },
+			expected:    []string{"a1 x", "b2 x", "a5 x"},
+			breadcrumbs: "1:x"},
+		{
+			action:      func() error { return fs.push("/^a/") },
+			expected:    []string{"a1 x", "a5 x"},
+			breadcrumbs: "1:x > 2:/^a/"},
+		{
+			action:      func() error { return fs.push("not 5") },
+			expected:    []string{"a1 x"},
+			breadcrumbs: "1:x > 2:/^a/ > 3:not 5"},
+		{
+			action:      func() error { fs.toggle(1); return nil },
+			expected:    []string{"a1 x", "b2 x"},
+			breadcrumbs: "1:x > 2:(/^a/) > 3:not 5"},
+		{
+			action:      func() error { fs.toggle(0); return nil },
+			expected:    []string{"a1 x", "b2 x", "a3 y", "b4 y"},
+			breadcrumbs: "1:(x) > 2:(/^a/) > 3:not 5"},
+		{
+			action:      func() error { fs.toggle(1); return nil },
+			expected:    []string{"a1 x", "a3 y"},
+			breadcrumbs: "1:(x) > 2:/^a/ > 3:not 5"},
+		{
+			action:      func() error { fs.pop(); return nil },
+			expected:    []string{"a1 x", "a3 y", "a5 x"},
+			breadcrumbs: "1:(x) > 2:/^a/"},
+		{
+			action:      func() error { fs.toggle(0); return nil },
+			expected:    []string{"a1 x", "a5 x"},
+			breadcrumbs: "1:x > 2:/^a/"},
+	}
+
+	for n, s := range steps {
+		if err := s.action(); err != nil {
+			t.Errorf("Step %v: failed: %v", n, err)
+			continue
+		}
+		if observed := stackContents(fs); !reflect.DeepEqual(observed, s.expected) {
+			t.Errorf("Step %v: want: %q, have: %q", n, s.expected, observed)
+		}
+		if observed := fs.breadcrumbs(); observed != s.breadcrumbs {
+			t.Errorf("Step %v: breadcrumbs want: %q, have: %q", n, s.breadcrumbs, observed)
+		}
+	}
+}
+
+func TestFilterStackKeepsLowerLayers(t *testing.T) {
+	fm := newFileMock("a1\nb2\na3\n")
+	fs := newFilterStack(NewTextFile(fm, 3), plainTextField)
+	for _, expression := range []string{"a or b", "not 2", "3"} {
+		if err := fs.push(expression); err != nil {
+			t.Fatalf("push(%q) failed: %v", expression, err)
+		}
+	}
+	bottom := fs.layers[0].src
+
+	fs.toggle(1)
+	if fs.layers[0].src != bottom {
+		t.Errorf("toggle() of upper layer filtered the bottom layer again")
+	}
+	if _, ok := fs.layers[2].src.(*narrowedLines); !ok {
+		t.Errorf("toggle() top layer want: narrowed lines of the bottom one, have: %T", fs.layers[2].src)
+	}
+	fs.pop()
+	fs.pop()
+	if fs.source() != bottom {
+		t.Errorf("pop() filtered the bottom layer again")
+	}
+	fs.wait()
+	if count, known := fs.rowsCount(); !known || count != 3 {
+		t.Errorf("rowsCount() want: 3 true, have: %v %v", count, known)
+	}
+}
+
+func TestInvalidFilterLayer(t *testing.T) {
+	fs := newFilterStack(NewTextFile(newFileMock("a\n"), 3), plainTextField)
+	if err := fs.push("(a"); err == nil {
+		t.Errorf("push() of invalid expression succeeded")
+	}
+	if len(fs.layers) != 0 {
+		t.Errorf("invalid layer was added: %v", fs.breadcrumbs())
+	}
+}
+
+func TestNarrowingGrowingFile(t *testing.T) {
+	fm := newFileMock("a1\nb2\n")
+	fs := newFilterStack(NewTextFile(fm, 3), plainTextField)
+	fs.push("a or b")
+	fs.push("not 2")
+	stackContents(fs)
+
+	fm.contents += "a3\nb4\n"
+	fs.update()
+	expected := []string{"a1", "a3", "b4"}
+	if observed := stackContents(fs); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+
+	// unfinished line is narrowed only when it is finished
+	fm.contents += "a5"
+	fs.update()
+	expected = []string{"a1", "a3", "b4"}
+	if observed := stackContents(fs); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+	fm.contents += "\n"
+	fs.update()
+	expected = []string{"a1", "a3", "b4", "a5"}
+	if observed := stackContents(fs); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+
+	fm.contents = "b5\n"
+	if change := fs.update(); change != fileTruncated {
+		t.Errorf("update() of truncated file. want: %v, have: %v", fileTruncated, change)
+	}
+	expected = []string{"b5"}
+	if observed := stackContents(fs); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+}
+
+func TestNarrowingLinesAtOnce(t *testing.T) {
+	var contents strings.Builder
+	for i := 0; i != 40; i++ {
+		fmt.Fprintf(&contents, "a%v\n", i)
+	}
+	fm := newFileMock(contents.String())
+	fs := newFilterStack(NewTextFile(fm, 10), plainTextField)
+	fs.push("a")
+	fs.push("1")
+	fs.wait()
+
+	fm.seeks = 0
+	if rows := fs.source().(matchSource).matchesAt(0, 100); len(rows) != 13 {
+		t.Errorf("number of rows want: 13, have: %v", len(rows))
+	}
+	if fm.seeks != 1 {
+		t.Errorf("40 lines following each other were read from %v places", fm.seeks)
+	}
+
+	fm.seeks = 0
+	lines := fs.lines(0, 100)
+	if len(lines) != 13 || lines[1].Contents != "a10" || lines[12].Contents != "a31" {
+		t.Errorf("narrowed lines want: a1, a10, ..., a31, have: %v", lines)
+	}
+	if fm.seeks != 4 {
+		t.Errorf("lines in 4 runs were read from %v places", fm.seeks)
+	}
+}
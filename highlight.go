@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/marcusolsson/tui-go"
+)
+
+// levelStyles are names of styles of lines by their level
+var levelStyles = map[logLevel]string{
+	levelTrace: "level.trace",
+	levelDebug: "level.debug",
+	levelInfo:  "level.info",
+	levelWarn:  "level.warn",
+	levelError: "level.error",
+	levelFatal: "level.fatal",
+}
+
+// defaultStyles are styles of levels and tokens, unless the user sets them
+var defaultStyles = map[string]tui.Style{
+	"context":         {Fg: tui.ColorBlue},
+	"level.trace":     {Fg: tui.ColorCyan},
+	"level.debug":     {Fg: tui.ColorCyan},
+	"level.info":      {},
+	"level.warn":      {Fg: tui.ColorYellow},
+	"level.error":     {Fg: tui.ColorRed},
+	"level.fatal":     {Fg: tui.ColorWhite, Bg: tui.ColorRed, Bold: tui.DecorationOn},
+	"token.timestamp": {Fg: tui.ColorGreen},
+	"token.ip":        {Fg: tui.ColorMagenta},
+	"token.uuid":      {Fg: tui.ColorMagenta},
+	"token.url":       {Fg: tui.ColorBlue, Underline: tui.DecorationOn},
+	"token.string":    {Fg: tui.ColorYellow},
+	"token.number":    {Fg: tui.ColorCyan},
+	"search":          {Fg: tui.ColorBlack, Bg: tui.ColorYellow},
+	"control":         {Reverse: tui.DecorationOn},
+}
+
+// tokenPattern matches highlighted tokens, names of its groups are names of
+// their styles. Earlier groups win, so parts of timestamps are not numbers
+var tokenPattern = regexp.MustCompile(strings.Join([]string{
+	`(?P<timestamp>` + grokPatterns["TIMESTAMP_ISO8601"] + `|` + grokPatterns["SYSLOGTIMESTAMP"] + `|` +
+		grokPatterns["HTTPDATE"] + `|\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?\b)`,
+	`(?P<url>\b[a-z][a-z0-9+.-]*://[^\s"'<>]+)`,
+	`(?P<uuid>\b` + grokPatterns["UUID"] + `\b)`,
+	`(?P<ip>\b(?:\d{1,3}\.){3}\d{1,3}\b)`,
+	`(?P<string>` + grokPatterns["QS"] + `)`,
+	`(?P<number>\b\d+(?:\.\d+)?\b)`,
+}, "|"))
+
+// highlightSpan is a part of shown text with its style, empty for the
+// style of the whole line
+type highlightSpan struct {
+	text  string
+	style string
+}
+
+// highlightTokens splits the text into spans of tokens and the text between
+// them
+func highlightTokens(text string) []highlightSpan {
+	var result []highlightSpan
+	names := tokenPattern.SubexpNames()
+	last := 0
+	for _, m := range tokenPattern.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > last {
+			result = append(result, highlightSpan{text[last:m[0]], ""})
+		}
+		for n := 1; n < len(names); n++ {
+			if m[2*n] >= 0 {
+				result = append(result, highlightSpan{text[m[0]:m[1]], "token." + names[n]})
+				break
+			}
+		}
+		last = m[1]
+	}
+	if last < len(text) || len(result) == 0 {
+		result = append(result, highlightSpan{text[last:], ""})
+	}
+	return result
+}
+
+// highlightSearch splits the text into spans of matches of the searched
+// pattern and spans of tokens between them
+func highlightSearch(text string, pattern *regexp.Regexp) []highlightSpan {
+	var result []highlightSpan
+	last := 0
+	for _, m := range pattern.FindAllStringIndex(text, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		if m[0] > last {
+			result = append(result, highlightTokens(text[last:m[0]])...)
+		}
+		result = append(result, highlightSpan{text[m[0]:m[1]], "search"})
+		last = m[1]
+	}
+	if last < len(text) || len(result) == 0 {
+		result = append(result, highlightTokens(text[last:])...)
+	}
+	return result
+}
+
+// lineLevel returns level of the line, given by its level field in
+// structured logs or by a level name among its first words
+func lineLevel(format *logFormat, line FileLine) logLevel {
+	field := plainTextField
+	if format != nil {
+		field = format.field
+	}
+	if name, ok := field(line, "level"); ok {
+		if l, ok := parseLogLevel(name); ok {
+			return l
+		}
+	}
+	return levelUnknown
+}
+
+// styleColors are names of colors in style definitions
+var styleColors = map[string]tui.Color{
+	"default": tui.ColorDefault,
+	"black":   tui.ColorBlack,
+	"white":   tui.ColorWhite,
+	"red":     tui.ColorRed,
+	"green":   tui.ColorGreen,
+	"blue":    tui.ColorBlue,
+	"cyan":    tui.ColorCyan,
+	"magenta": tui.ColorMagenta,
+	"yellow":  tui.ColorYellow,
+}
+
+// parseStyle parses style like "white on red bold": foreground color,
+// optionally background color after "on", and decorations bold, underline
+// and reverse
+func parseStyle(text string) (tui.Style, error) {
+	var result tui.Style
+	words := strings.Fields(text)
+	for n := 0; n < len(words); n++ {
+		word := words[n]
+		switch {
+		case word == "bold":
+			result.Bold = tui.DecorationOn
+		case word == "underline":
+			result.Underline = tui.DecorationOn
+		case word == "reverse":
+			result.Reverse = tui.DecorationOn
+		case word == "on" && n+1 < len(words):
+			n++
+			c, ok := styleColors[words[n]]
+			if !ok {
+				return result, fmt.Errorf("unknown color %q", words[n])
+			}
+			result.Bg = c
+		default:
+			c, ok := styleColors[word]
+			if !ok {
+				return result, fmt.Errorf("unknown color %q", word)
+			}
+			result.Fg = c
+		}
+	}
+	return result, nil
+}
+
+// readStyles reads styles given as lines like "level.error = red bold".
+// Lines starting with # are comments
+func readStyles(r io.Reader, fileName string) (map[string]tui.Style, error) {
+	result := make(map[string]tui.Style)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected name = style", fileName, lineNumber)
+		}
+		name := strings.TrimSpace(kv[0])
+		if _, ok := defaultStyles[name]; !ok {
+			return nil, fmt.Errorf("%v:%v: unknown style %q", fileName, lineNumber, name)
+		}
+		style, err := parseStyle(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", fileName, lineNumber, err)
+		}
+		result[name] = style
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// defaultStylesPath returns path of the file with user defined styles
+func defaultStylesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "logviewer", "styles.conf")
+}
+
+// loadStyles returns default styles overridden by the ones in the file.
+// Missing file is an error, only if it must exist
+func loadStyles(path string, mustExist bool) (map[string]tui.Style, error) {
+	result := make(map[string]tui.Style)
+	for name, style := range defaultStyles {
+		result[name] = style
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !mustExist {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	styles, err := readStyles(f, path)
+	if err != nil {
+		return nil, err
+	}
+	for name, style := range styles {
+		result[name] = style
+	}
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/marcusolsson/tui-go"
+)
+
+func TestHighlightingTokens(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected []highlightSpan
+	}{
+		{"", []highlightSpan{{"", ""}}},
+		{"no tokens", []highlightSpan{{"no tokens", ""}}},
+		{"2019-11-25T10:00:01.250Z took 12.5 ms", []highlightSpan{
+			{"2019-11-25T10:00:01.250Z", "token.timestamp"}, {" took ", ""}, {"12.5", "token.number"}, {" ms", ""}}},
+		{"Nov 25 10:00:01 host sshd[42]: from 10.0.0.1", []highlightSpan{
+			{"Nov 25 10:00:01", "token.timestamp"}, {" host sshd[", ""}, {"42", "token.number"}, {"]: from ", ""}, {"10.0.0.1", "token.ip"}}},
+		{`GET https://example.com/a?b=1 "curl/7.0"`, []highlightSpan{
+			{"GET ", ""}, {"https://example.com/a?b=1", "token.url"}, {" ", ""}, {`"curl/7.0"`, "token.string"}}},
+		{"id=123e4567-e89b-12d3-a456-426614174000", []highlightSpan{
+			{"id=", ""}, {"123e4567-e89b-12d3-a456-426614174000", "token.uuid"}}},
+		{"v2 x10", []highlightSpan{{"v2 x10", ""}}},
+	}
+
+	for n, c := range testCases {
+		if observed := highlightTokens(c.text); !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.expected, observed)
+		}
+	}
+}
+
+func TestLineLevel(t *testing.T) {
+	json, _ := findLogFormat("json")
+	syslog, _ := findLogFormat("syslog")
+	testCases := []struct {
+		format   *logFormat
+		contents string
+		expected logLevel
+	}{
+		{nil, "10:00:01 WARN disk full", levelWarn},
+		{nil, "10:00:01 [main] ERR failed", levelError},
+		{nil, "no error here", levelUnknown},
+		{json, `{"level":"debug","msg":"x"}`, levelDebug},
+		{json, `{"level":60,"msg":"x"}`, levelFatal},
+		{json, `{"msg":"ERROR in message"}`, levelUnknown},
+		{json, "\tat main.go:12 ERROR", levelError},
+		{syslog, "<11>Nov 25 10:00:01 host app: failed", levelError},
+		{syslog, "<15>1 2019-11-25T10:00:01Z host app - - - debugging", levelDebug},
+	}
+
+	for n, c := range testCases {
+		if observed := lineLevel(c.format, FileLine{Contents: c.contents}); observed != c.expected {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.expected, observed)
+		}
+	}
+}
+
+func TestReadingStyles(t *testing.T) {
+	testCases := []struct {
+		contents string
+		expected map[string]tui.Style
+		err      string
+	}{
+		{"# styles\n\nlevel.error = white on red bold\ntoken.url = underline\n", map[string]tui.Style{
+			"level.error": {Fg: tui.ColorWhite, Bg: tui.ColorRed, Bold: tui.DecorationOn},
+			"token.url":   {Underline: tui.DecorationOn},
+		}, ""},
+		{"level.error red\n", nil, "f:1: expected name = style"},
+		{"\nlevel.oops = red\n", nil, `f:2: unknown style "level.oops"`},
+		{"level.warn = orange\n", nil, `f:1: unknown color "orange"`},
+		{"level.warn = red on pink\n", nil, `f:1: unknown color "pink"`},
+	}
+
+	for n, c := range testCases {
+		observed, err := readStyles(strings.NewReader(c.contents), "f")
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("Case %v: want: %v, have: %v", n, c.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %v, have: %v %v", n, c.expected, observed, err)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// indexCacheBlockSize is size of blocks of the file, which hashes are used to
+// check if the cached index still describes the file
+const indexCacheBlockSize = 4096
+
+// diskFile is implemented by files on disk, e.g. *os.File
+type diskFile interface {
+	Name() string
+	Stat() (os.FileInfo, error)
+}
+
+// indexCacheEntry is a lineIndex saved in the cache directory
+type indexCacheEntry struct {
+	Path        string
+	Size        int64
+	ModTime     time.Time
+	FirstHash   []byte // hash of the first block of the file
+	LastHash    []byte // hash of the block before IndexedSize
+	Interval    uint
+	Encoding    string // lines are split on line endings of the encoding
+	LinesCount  uint
+	IndexedSize int64
+	Checkpoints []int64
+}
+
+// indexCachePath returns name of the file keeping index of file at given path
+func indexCachePath(path string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(dir, "logviewer", hex.EncodeToString(sum[:])+".idx"), nil
+}
+
+// blockHash returns hash of size bytes of the file ending at end position
+func blockHash(ra io.ReaderAt, end int64) ([]byte, error) {
+	start := Max(0, end-indexCacheBlockSize)
+	b := make([]byte, end-start)
+	if _, err := ra.ReadAt(b, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+func firstBlockHash(ra io.ReaderAt, size int64) ([]byte, error) {
+	return blockHash(ra, Min(size, indexCacheBlockSize))
+}
+
+// loadLineIndex restores li from the cache, if the file was not changed since
+// the index was saved or if it only grew
+func loadLineIndex(f diskFile, ra io.ReaderAt, li *lineIndex) bool {
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		return false
+	}
+	cachePath, err := indexCachePath(path)
+	if err != nil {
+		return false
+	}
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return false
+	}
+	var entry indexCacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if entry.Path != path || entry.Interval != li.interval || entry.Encoding != li.enc.name || len(entry.Checkpoints) == 0 {
+		return false
+	}
+	unchanged := info.Size() == entry.Size && info.ModTime().Equal(entry.ModTime)
+	if !unchanged && info.Size() <= entry.Size {
+		return false
+	}
+	firstHash, err := firstBlockHash(ra, entry.Size)
+	if err != nil || !bytes.Equal(firstHash, entry.FirstHash) {
+		return false
+	}
+	lastHash, err := blockHash(ra, entry.IndexedSize)
+	if err != nil || !bytes.Equal(lastHash, entry.LastHash) {
+		return false
+	}
+
+	li.restore(entry.LinesCount, entry.IndexedSize, entry.Checkpoints)
+	return true
+}
+
+// saveLineIndex writes li to the cache
+func saveLineIndex(f diskFile, ra io.ReaderAt, li *lineIndex) error {
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		return err
+	}
+	cachePath, err := indexCachePath(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	entry := indexCacheEntry{}
+	entry.Path = path
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+	entry.Interval = li.interval
+	entry.Encoding = li.enc.name
+	entry.LinesCount, entry.IndexedSize, entry.Checkpoints = li.snapshot()
+	if entry.FirstHash, err = firstBlockHash(ra, entry.Size); err != nil {
+		return err
+	}
+	if entry.LastHash, err = blockHash(ra, entry.IndexedSize); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&entry); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	// written to a temporary file first, so other instances never read
+	// half-written index
+	tmpPath := cachePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, cachePath)
+}
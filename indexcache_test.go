@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logviewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	name := filepath.Join(dir, "app.log")
+	writeFile := func(contents string) *namedFile {
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		nf, err := openNamedFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nf
+	}
+
+	nf := writeFile("0\n1\n2\n3\n4\n")
+	li := newLineIndex(2)
+	if loadLineIndex(nf, nf, li) {
+		t.Errorf("loadLineIndex() loaded index which was not saved")
+	}
+	li.build(nf)
+	if err := saveLineIndex(nf, nf, li); err != nil {
+		t.Fatalf("saveLineIndex() failed: %v", err)
+	}
+	nf.Close()
+
+	nf, err = openNamedFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := newLineIndex(2)
+	if !loadLineIndex(nf, nf, loaded) {
+		t.Errorf("loadLineIndex() did not load saved index")
+	}
+	if !reflect.DeepEqual(loaded.checkpoints, li.checkpoints) || loaded.linesCount != li.linesCount {
+		t.Errorf("loaded index want: %v %v, have: %v %v", li.checkpoints, li.linesCount, loaded.checkpoints, loaded.linesCount)
+	}
+	if loadLineIndex(nf, nf, newLineIndex(4)) {
+		t.Errorf("loadLineIndex() loaded index of different interval")
+	}
+	nf.Close()
+
+	nf = writeFile("0\n1\n2\n3\n4\n5\n6\n")
+	grown := newLineIndex(2)
+	if !loadLineIndex(nf, nf, grown) {
+		t.Errorf("loadLineIndex() did not load index of grown file")
+	}
+	grown.build(nf)
+	if expected := []int64{0, 4, 8, 12}; !reflect.DeepEqual(grown.checkpoints, expected) {
+		t.Errorf("extended index want: %v, have: %v", expected, grown.checkpoints)
+	}
+	nf.Close()
+
+	nf = writeFile("9\n1\n2\n3\n4\n5\n6\n7\n")
+	if loadLineIndex(nf, nf, newLineIndex(2)) {
+		t.Errorf("loadLineIndex() loaded index of modified file")
+	}
+	nf.Close()
+
+	nf = writeFile("0\n1\n")
+	if loadLineIndex(nf, nf, newLineIndex(2)) {
+		t.Errorf("loadLineIndex() loaded index of truncated file")
+	}
+	nf.Close()
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Deflate decoder, which unlike compress/flate tells where its blocks start,
+// so decoding can resume at a block boundary given the last 32 KiB of output
+// preceding it (like zran.c of zlib)
+
+const (
+	inflateWindowSize = 1 << 15
+	maxCodeBits       = 15
+	fastCodeBits      = 9
+)
+
+var errCorruptDeflate = errors.New("corrupt deflate data")
+
+var (
+	lengthBase  = [29]uint16{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]uint8{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distBase    = [30]uint16{1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577}
+	distExtra   = [30]uint8{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+	codeOrder   = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+)
+
+// bitReader reads bits of deflate data, starting from the least significant
+// bit of each byte
+type bitReader struct {
+	r      io.ByteReader
+	bits   uint64
+	nbits  uint
+	offset int64 // position of the next bit in the compressed data
+}
+
+// fill reads bytes until at least n bits are buffered or data ends
+func (br *bitReader) fill(n uint) {
+	for br.nbits < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			return
+		}
+		br.bits |= uint64(b) << br.nbits
+		br.nbits += 8
+	}
+}
+
+func (br *bitReader) drop(n uint) {
+	br.bits >>= n
+	br.nbits -= n
+	br.offset += int64(n)
+}
+
+func (br *bitReader) read(n uint) (uint32, error) {
+	br.fill(n)
+	if br.nbits < n {
+		return 0, io.ErrUnexpectedEOF
+	}
+	v := uint32(br.bits & (1<<n - 1))
+	br.drop(n)
+	return v, nil
+}
+
+func (br *bitReader) alignToByte() {
+	br.drop(br.nbits % 8)
+}
+
+// readByte reads a byte of data following the deflate stream or of a stored
+// block. The reader must be aligned to a byte
+func (br *bitReader) readByte() (byte, error) {
+	if br.nbits >= 8 {
+		b := byte(br.bits)
+		br.drop(8)
+		return b, nil
+	}
+	b, err := br.r.ReadByte()
+	if err == nil {
+		br.offset += 8
+	}
+	return b, err
+}
+
+// huffman is a canonical Huffman code. Codes up to fastCodeBits long are
+// decoded with a lookup table
+type huffman struct {
+	counts  [maxCodeBits + 1]uint16
+	symbols []uint16
+	fast    [1 << fastCodeBits]uint16 // symbol<<4 | code length, 0 for longer codes
+}
+
+func reverseBits(code int, length int) int {
+	result := 0
+	for i := 0; i < length; i++ {
+		result = result<<1 | code&1
+		code >>= 1
+	}
+	return result
+}
+
+func (h *huffman) init(lengths []uint8) error {
+	h.counts = [maxCodeBits + 1]uint16{}
+	for _, l := range lengths {
+		h.counts[l]++
+	}
+	h.counts[0] = 0
+	left := 1
+	for l := 1; l <= maxCodeBits; l++ {
+		left = left<<1 - int(h.counts[l])
+		if left < 0 {
+			return errCorruptDeflate
+		}
+	}
+
+	var offsets [maxCodeBits + 2]uint16
+	for l := 1; l <= maxCodeBits; l++ {
+		offsets[l+1] = offsets[l] + h.counts[l]
+	}
+	h.symbols = make([]uint16, offsets[maxCodeBits+1])
+	for symbol, l := range lengths {
+		if l != 0 {
+			h.symbols[offsets[l]] = uint16(symbol)
+			offsets[l]++
+		}
+	}
+
+	h.fast = [1 << fastCodeBits]uint16{}
+	code, index := 0, 0
+	for l := 1; l <= fastCodeBits; l++ {
+		for k := 0; k < int(h.counts[l]); k++ {
+			entry := h.symbols[index]<<4 | uint16(l)
+			for i := reverseBits(code, l); i < len(h.fast); i += 1 << uint(l) {
+				h.fast[i] = entry
+			}
+			code++
+			index++
+		}
+		code <<= 1
+	}
+	return nil
+}
+
+var fixedCodes struct {
+	once sync.Once
+	lit  huffman
+	dist huffman
+}
+
+func fixedHuffmanCodes() (*huffman, *huffman) {
+	fixedCodes.once.Do(func() {
+		var lengths [288]uint8
+		for i := range lengths {
+			switch {
+			case i < 144:
+				lengths[i] = 8
+			case i < 256:
+				lengths[i] = 9
+			case i < 280:
+				lengths[i] = 7
+			default:
+				lengths[i] = 8
+			}
+		}
+		fixedCodes.lit.init(lengths[:])
+		for i := 0; i < 30; i++ {
+			lengths[i] = 5
+		}
+		fixedCodes.dist.init(lengths[:30])
+	})
+	return &fixedCodes.lit, &fixedCodes.dist
+}
+
+type inflateState int
+
+const (
+	inflateBlockHeader inflateState = iota
+	inflateStoredBlock
+	inflateHuffmanBlock
+	inflateEnd
+)
+
+// inflater decodes a deflate stream. Read returns io.EOF after the final block
+type inflater struct {
+	br        *bitReader
+	hist      []byte // decoded data, the last inflateWindowSize bytes are history
+	hpos      int    // end of decoded data in hist
+	rpos      int    // start of decoded data not read yet
+	histBase  int64  // position of hist[0] in decoded data
+	state     inflateState
+	final     bool // the current block is the last one
+	stored    int  // bytes left of the stored block
+	lit, dist *huffman
+	dynLit    huffman
+	dynDist   huffman
+	copyLen   int // bytes left of the back reference
+	copyDist  int
+	err       error
+	// onBlock is called at start of each block with its position in the
+	// compressed data, position in decoded data and history preceding it
+	onBlock func(in int64, out int64, window []byte)
+}
+
+// newInflater decodes data of br. If it resumes decoding, window is the data
+// decoded before position out
+func newInflater(br *bitReader, window []byte, out int64) *inflater {
+	result := &inflater{}
+	result.br = br
+	result.hist = make([]byte, 4*inflateWindowSize)
+	result.hpos = copy(result.hist, window)
+	result.rpos = result.hpos
+	result.histBase = out - int64(result.hpos)
+	return result
+}
+
+// nextStream prepares decoding of another deflate stream following the last one
+func (f *inflater) nextStream() {
+	f.state = inflateBlockHeader
+	f.final = false
+	f.err = nil
+}
+
+func (f *inflater) Read(p []byte) (int, error) {
+	for f.rpos == f.hpos {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.err = f.step()
+	}
+	n := copy(p, f.hist[f.rpos:f.hpos])
+	f.rpos += n
+	return n, nil
+}
+
+// step decodes data until a block ends or hist is full
+func (f *inflater) step() error {
+	if f.hpos == len(f.hist) {
+		n := copy(f.hist, f.hist[f.hpos-inflateWindowSize:f.hpos])
+		f.histBase += int64(f.hpos - n)
+		f.hpos, f.rpos = n, n
+	}
+	switch f.state {
+	case inflateBlockHeader:
+		return f.readBlockHeader()
+	case inflateStoredBlock:
+		return f.copyStored()
+	case inflateHuffmanBlock:
+		return f.decodeBlock()
+	}
+	return io.EOF
+}
+
+func (f *inflater) readBlockHeader() error {
+	if f.final {
+		f.state = inflateEnd
+		return io.EOF
+	}
+	if f.onBlock != nil {
+		start := 0
+		if f.hpos > inflateWindowSize {
+			start = f.hpos - inflateWindowSize
+		}
+		f.onBlock(f.br.offset, f.histBase+int64(f.hpos), f.hist[start:f.hpos])
+	}
+	header, err := f.br.read(3)
+	if err != nil {
+		return err
+	}
+	f.final = header&1 == 1
+	switch header >> 1 {
+	case 0:
+		f.br.alignToByte()
+		var b [4]byte
+		for i := range b {
+			if b[i], err = f.br.readByte(); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		length := int(b[0]) | int(b[1])<<8
+		if length != ^(int(b[2])|int(b[3])<<8)&0xffff {
+			return errCorruptDeflate
+		}
+		f.stored = length
+		f.state = inflateStoredBlock
+	case 1:
+		f.lit, f.dist = fixedHuffmanCodes()
+		f.state = inflateHuffmanBlock
+	case 2:
+		if err := f.readDynamicCodes(); err != nil {
+			return err
+		}
+		f.lit, f.dist = &f.dynLit, &f.dynDist
+		f.state = inflateHuffmanBlock
+	default:
+		return errCorruptDeflate
+	}
+	return nil
+}
+
+func (f *inflater) readDynamicCodes() error {
+	var counts [3]uint32
+	for i, bits := range []uint{5, 5, 4} {
+		v, err := f.br.read(bits)
+		if err != nil {
+			return err
+		}
+		counts[i] = v
+	}
+	nlen, ndist, ncode := int(counts[0])+257, int(counts[1])+1, int(counts[2])+4
+	if nlen > 286 || ndist > 30 {
+		return errCorruptDeflate
+	}
+
+	var codeLengths [19]uint8
+	for i := 0; i < ncode; i++ {
+		v, err := f.br.read(3)
+		if err != nil {
+			return err
+		}
+		codeLengths[codeOrder[i]] = uint8(v)
+	}
+	var lencode huffman
+	if err := lencode.init(codeLengths[:]); err != nil {
+		return err
+	}
+
+	lengths := make([]uint8, nlen+ndist)
+	for index := 0; index < len(lengths); {
+		symbol, err := f.decode(&lencode)
+		if err != nil {
+			return err
+		}
+		if symbol < 16 {
+			lengths[index] = uint8(symbol)
+			index++
+			continue
+		}
+		var length uint8
+		var repeat uint32
+		switch symbol {
+		case 16:
+			if index == 0 {
+				return errCorruptDeflate
+			}
+			length = lengths[index-1]
+			repeat, err = f.br.read(2)
+			repeat += 3
+		case 17:
+			repeat, err = f.br.read(3)
+			repeat += 3
+		default:
+			repeat, err = f.br.read(7)
+			repeat += 11
+		}
+		if err != nil {
+			return err
+		}
+		if index+int(repeat) > len(lengths) {
+			return errCorruptDeflate
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[index] = length
+			index++
+		}
+	}
+	if lengths[256] == 0 {
+		return errCorruptDeflate
+	}
+	if err := f.dynLit.init(lengths[:nlen]); err != nil {
+		return err
+	}
+	return f.dynDist.init(lengths[nlen:])
+}
+
+func (f *inflater) copyStored() error {
+	for f.stored > 0 && f.hpos < len(f.hist) {
+		b, err := f.br.readByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		f.hist[f.hpos] = b
+		f.hpos++
+		f.stored--
+	}
+	if f.stored == 0 {
+		f.state = inflateBlockHeader
+	}
+	return nil
+}
+
+// decode reads a symbol of the Huffman code
+func (f *inflater) decode(h *huffman) (int, error) {
+	f.br.fill(fastCodeBits)
+	if entry := h.fast[f.br.bits&(1<<fastCodeBits-1)]; entry != 0 && uint(entry&15) <= f.br.nbits {
+		f.br.drop(uint(entry & 15))
+		return int(entry >> 4), nil
+	}
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxCodeBits; l++ {
+		bit, err := f.br.read(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.counts[l])
+		if code-count < first {
+			return int(h.symbols[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, errCorruptDeflate
+}
+
+func (f *inflater) decodeBlock() error {
+	for f.hpos < len(f.hist) {
+		if f.copyLen > 0 {
+			for ; f.copyLen > 0 && f.hpos < len(f.hist); f.copyLen-- {
+				f.hist[f.hpos] = f.hist[f.hpos-f.copyDist]
+				f.hpos++
+			}
+			continue
+		}
+		symbol, err := f.decode(f.lit)
+		if err != nil {
+			return err
+		}
+		switch {
+		case symbol < 256:
+			f.hist[f.hpos] = byte(symbol)
+			f.hpos++
+			continue
+		case symbol == 256:
+			f.state = inflateBlockHeader
+			return nil
+		case symbol > 285:
+			return errCorruptDeflate
+		}
+		symbol -= 257
+		extra, err := f.br.read(uint(lengthExtra[symbol]))
+		if err != nil {
+			return err
+		}
+		f.copyLen = int(lengthBase[symbol]) + int(extra)
+
+		symbol, err = f.decode(f.dist)
+		if err != nil {
+			return err
+		}
+		if symbol > 29 {
+			return errCorruptDeflate
+		}
+		if extra, err = f.br.read(uint(distExtra[symbol])); err != nil {
+			return err
+		}
+		f.copyDist = int(distBase[symbol]) + int(extra)
+		if f.copyDist > f.hpos {
+			return errCorruptDeflate
+		}
+	}
+	return nil
+}
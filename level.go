@@ -0,0 +1,86 @@
+package main
+
+import "strings"
+
+// logLevel is severity of a log line, common for all log formats
+type logLevel int
+
+const (
+	levelUnknown logLevel = iota
+	levelTrace
+	levelDebug
+	levelInfo
+	levelWarn
+	levelError
+	levelFatal
+)
+
+var logLevelNames = map[string]logLevel{
+	"TRACE":    levelTrace,
+	"TRC":      levelTrace,
+	"FINEST":   levelTrace,
+	"DEBUG":    levelDebug,
+	"DBG":      levelDebug,
+	"FINE":     levelDebug,
+	"INFO":     levelInfo,
+	"INF":      levelInfo,
+	"NOTICE":   levelInfo,
+	"WARN":     levelWarn,
+	"WARNING":  levelWarn,
+	"WRN":      levelWarn,
+	"ERROR":    levelError,
+	"ERR":      levelError,
+	"SEVERE":   levelError,
+	"FATAL":    levelFatal,
+	"FTL":      levelFatal,
+	"CRIT":     levelFatal,
+	"CRITICAL": levelFatal,
+	"PANIC":    levelFatal,
+	"EMERG":    levelFatal,
+	"ALERT":    levelFatal,
+}
+
+func (l logLevel) String() string {
+	switch l {
+	case levelTrace:
+		return "TRACE"
+	case levelDebug:
+		return "DEBUG"
+	case levelInfo:
+		return "INFO"
+	case levelWarn:
+		return "WARN"
+	case levelError:
+		return "ERROR"
+	case levelFatal:
+		return "FATAL"
+	}
+	return "UNKNOWN"
+}
+
+// parseLogLevel returns level of given name or one of its aliases
+func parseLogLevel(name string) (logLevel, bool) {
+	l, ok := logLevelNames[strings.ToUpper(name)]
+	return l, ok
+}
+
+// detectLevel looks for a level name among first words of the line. Only
+// upper case words are taken into account, so a message mentioning an "error"
+// is not taken for one
+func detectLevel(contents string) logLevel {
+	words := strings.FieldsFunc(contents, func(r rune) bool {
+		return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z')
+	})
+	for n, word := range words {
+		if n == 8 {
+			break
+		}
+		if word != strings.ToUpper(word) {
+			continue
+		}
+		if l, ok := parseLogLevel(word); ok {
+			return l
+		}
+	}
+	return levelUnknown
+}
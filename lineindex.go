@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"sync"
+)
+
+// lineIndexInterval is number of lines between checkpoints of the lineIndex
+const lineIndexInterval = 1024
+
+const lineIndexBufferSize = 64 * 1024
+
+// lineIndex keeps positions of every interval-th line of the file, so reading
+// any line needs scanning only a short part of the file. It is built in
+// background, so it is safe for concurrent use
+type lineIndex struct {
+	mu          sync.Mutex
+	interval    uint
+	enc         *textEncoding // encoding of line endings
+	checkpoints []int64       // checkpoints[i] is position of line i*interval
+	linesCount  uint          // number of lines indexed so far
+	indexedSize int64         // position after the last indexed line
+	building    bool
+	completed   bool // whole file was indexed at least once
+	saved       bool
+	savedCount  uint // linesCount when the index was saved
+}
+
+func newLineIndex(interval uint) *lineIndex {
+	result := &lineIndex{}
+	result.interval = interval
+	result.enc = utf8Encoding
+	result.checkpoints = []int64{0}
+	return result
+}
+
+// build indexes the file from the last indexed line up to the end of file. It
+// returns immediately if the index is being built already
+func (li *lineIndex) build(ra io.ReaderAt) {
+	li.mu.Lock()
+	if li.building {
+		li.mu.Unlock()
+		return
+	}
+	li.building = true
+	pos := li.indexedSize
+	count := li.linesCount
+	li.mu.Unlock()
+
+	b := make([]byte, lineIndexBufferSize)
+	var prev byte
+	for {
+		n, err := ra.ReadAt(b, pos)
+
+		var found []int64
+		lineEnd := int64(-1)
+		li.enc.lineEnds(b[:n], pos, prev, func(end int64) {
+			count++
+			lineEnd = end
+			if count%li.interval == 0 {
+				found = append(found, lineEnd)
+			}
+		})
+		pos += int64(n)
+		if n != 0 {
+			prev = b[n-1]
+		}
+
+		li.mu.Lock()
+		li.checkpoints = append(li.checkpoints, found...)
+		if lineEnd != -1 {
+			li.linesCount = count
+			li.indexedSize = lineEnd
+		}
+		li.mu.Unlock()
+
+		if err != nil || n == 0 {
+			break
+		}
+	}
+
+	li.mu.Lock()
+	li.building = false
+	li.completed = true
+	li.mu.Unlock()
+}
+
+// checkpoint returns the closest indexed line at or before lineIndex and its
+// position
+func (li *lineIndex) checkpoint(lineIndex uint) (uint, int64) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	i := lineIndex / li.interval
+	if i >= uint(len(li.checkpoints)) {
+		i = uint(len(li.checkpoints)) - 1
+	}
+	return i * li.interval, li.checkpoints[i]
+}
+
+// checkpointBefore returns the closest indexed line starting at or before the
+// position and its position
+func (li *lineIndex) checkpointBefore(position int64) (uint, int64) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	i := sort.Search(len(li.checkpoints), func(i int) bool {
+		return li.checkpoints[i] > position
+	}) - 1
+	return uint(i) * li.interval, li.checkpoints[i]
+}
+
+// count returns number of lines in the file, once the whole file is indexed
+func (li *lineIndex) count() (uint, bool) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	return li.linesCount, li.completed
+}
+
+// end returns position after the last indexed line
+func (li *lineIndex) end() int64 {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	return li.indexedSize
+}
+
+// restore sets index to previously saved state, so building it continues
+// after the last indexed line
+func (li *lineIndex) restore(linesCount uint, indexedSize int64, checkpoints []int64) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	li.linesCount = linesCount
+	li.indexedSize = indexedSize
+	li.checkpoints = checkpoints
+	li.saved = true
+	li.savedCount = linesCount
+}
+
+// snapshot returns state of the index, which can be restored later
+func (li *lineIndex) snapshot() (uint, int64, []int64) {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	checkpoints := make([]int64, len(li.checkpoints))
+	copy(checkpoints, li.checkpoints)
+	return li.linesCount, li.indexedSize, checkpoints
+}
+
+// needsSaving tells if a new checkpoint was added since the index was saved,
+// and marks it as saved
+func (li *lineIndex) needsSaving() bool {
+	li.mu.Lock()
+	defer li.mu.Unlock()
+	if li.saved && li.linesCount/li.interval == li.savedCount/li.interval {
+		return false
+	}
+	li.saved = true
+	li.savedCount = li.linesCount
+	return true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildingLineIndex(t *testing.T) {
+	fm := newFileMock("0\n1\n2\n3\n4\n5\n6")
+	li := newLineIndex(2)
+	li.build(fm)
+
+	if !reflect.DeepEqual(li.checkpoints, []int64{0, 4, 8, 12}) {
+		t.Errorf("checkpoints want: %v, have: %v", []int64{0, 4, 8, 12}, li.checkpoints)
+	}
+	if count, known := li.count(); !known || count != 6 {
+		t.Errorf("count() want: %v, have: %v (known: %v)", 6, count, known)
+	}
+
+	fm.contents += "\n7\n"
+	li.build(fm)
+	if !reflect.DeepEqual(li.checkpoints, []int64{0, 4, 8, 12, 16}) {
+		t.Errorf("checkpoints want: %v, have: %v", []int64{0, 4, 8, 12, 16}, li.checkpoints)
+	}
+	if count, _ := li.count(); count != 8 {
+		t.Errorf("count() want: %v, have: %v", 8, count)
+	}
+
+	testCases := []struct {
+		lineIndex    uint
+		expectedLine uint
+		expectedPos  int64
+	}{
+		{0, 0, 0},
+		{1, 0, 0},
+		{2, 2, 4},
+		{5, 4, 8},
+		{7, 6, 12},
+		{100, 8, 16},
+	}
+	for n, c := range testCases {
+		line, pos := li.checkpoint(c.lineIndex)
+		if line != c.expectedLine || pos != c.expectedPos {
+			t.Errorf("Case %v: checkpoint() want: %v %v, have: %v %v", n, c.expectedLine, c.expectedPos, line, pos)
+		}
+	}
+}
+
+func TestIndexedTextFile(t *testing.T) {
+	rs := newFileMock("1st\n2nd\n3rd\n4th\n5th\n")
+	tf := NewTextFile(rs, 2)
+	tf.index = newLineIndex(2)
+	tf.index.build(rs)
+
+	testCases := []textFileTestCase{
+		{
+			startingLineIndex: 3,
+			CacheSize:         2,
+			Lines: map[uint]FileLine{
+				3: FileLine{Contents: "4th", position: 12},
+				4: FileLine{Contents: "5th", position: 16}}},
+		{
+			startingLineIndex: 1,
+			CacheSize:         2,
+			Lines: map[uint]FileLine{
+				1: FileLine{Contents: "2nd", position: 4},
+				2: FileLine{Contents: "3rd", position: 8}}},
+		{
+			startingLineIndex: 4,
+			CacheSize:         2,
+			Lines: map[uint]FileLine{
+				4: FileLine{Contents: "5th", position: 16}}},
+		{
+			startingLineIndex: 0,
+			CacheSize:         2,
+			Lines: map[uint]FileLine{
+				0: FileLine{Contents: "1st", position: 0},
+				1: FileLine{Contents: "2nd", position: 4}}},
+	}
+	for n, c := range testCases {
+		tf.goTo(c.startingLineIndex)
+		if !reflect.DeepEqual(tf.CachedLines, c.Lines) {
+			t.Errorf("Op %v: expect: %v, have: %v", n, c.Lines, tf.CachedLines)
+		}
+	}
+
+	if count, known := tf.rowsCount(); !known || count != 5 {
+		t.Errorf("rowsCount() want: %v, have: %v (known: %v)", 5, count, known)
+	}
+}
@@ -2,42 +2,129 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/marcusolsson/tui-go"
 )
 
-const filepath = "d:/files/log.txt"
-const visibleLinesCount = 1
-const marginLinesCount = 1
+// newOptionsPager returns pager of the source, at the line given in options
+func newOptionsPager(src lineSource, opts *options) *pager {
+	p := newPager(src, opts.cacheSize-marginLinesCount)
+	p.following = opts.follow
+	if opts.follow {
+		p.end()
+	} else {
+		p.goToLine(startLineOf(src, opts))
+	}
+	return p
+}
 
-func newUI(filename string) tui.Widget {
+func newViews(opts *options, inputs []io.ReadSeeker) ([]*fileView, error) {
+	renderer := newTextRenderer(!opts.stripANSI, int(opts.tabWidth))
+	if opts.merge {
+		name := fmt.Sprintf("merged %v files", len(inputs))
+		p := newOptionsPager(newMergedSource(inputs, opts), opts)
+		fv := newFileView(name, nil, p)
+		fv.renderer = renderer
+		fv.render()
+		return []*fileView{fv}, nil
+	}
+	var views []*fileView
+	for n, rs := range inputs {
+		tf := openTextFile(rs, opts)
+		format := logFormatOf(tf, opts)
+		tf.logFormat = format
+		filters, err := newFilteredSource(tf, format, opts)
+		if err != nil {
+			return nil, err
+		}
+		fv := newFileView(displayName(opts.files[n]), filters, newOptionsPager(filters, opts))
+		fv.renderer = renderer
+		fv.setColumns(format, opts.columns)
+		views = append(views, fv)
+	}
+	return views, nil
+}
 
-	filenameLabel := tui.NewLabel(filename)
-	headersBox := tui.NewHBox(filenameLabel)
-	headersBox.SetBorder(true)
-	//	headersBox.si
+func runUI(opts *options, inputs []io.ReadSeeker) error {
+	views, err := newViews(opts, inputs)
+	if err != nil {
+		return err
+	}
 
-	fileLines := tui.NewTable(0, 0)
-	for i := 0; i != 10; i++ {
-		fileLines.AppendRow(tui.NewLabel(fmt.Sprintf("line %v", i)))
+	stylesPath := opts.styles
+	if stylesPath == "" {
+		stylesPath = defaultStylesPath()
+	}
+	styles, err := loadStyles(stylesPath, opts.styles != "")
+	if err != nil {
+		return fmt.Errorf("invalid styles: %v", err)
 	}
 
-	debugLines := tui.NewTable(0, 0)
-	for i := 0; i != 5; i++ {
-		fileLines.AppendRow(tui.NewLabel(fmt.Sprintf("debug %v", i)))
+	v := newViewer(views, opts.follow)
+	ui, err := tui.New(newUI(v))
+	if err != nil {
+		return err
 	}
 
-	return tui.NewVBox(headersBox, fileLines, debugLines)
+	ui.SetTheme(newTheme(styles))
+	v.bindKeys(ui)
+	v.startPolling(ui)
+	ui.SetKeybinding("Ctrl+C", func() { ui.Quit() })
+
+	return ui.Run()
 }
 
-func main() {
-	fmt.Println("Started...")
+func runPrint(opts *options, inputs []io.ReadSeeker) error {
+	if opts.merge {
+		return printLines(os.Stdout, newMergedSource(inputs, opts), opts)
+	}
+	for n, rs := range inputs {
+		if len(inputs) > 1 {
+			if n > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %v <==\n", displayName(opts.files[n]))
+		}
+		tf := openTextFile(rs, opts)
+		tf.logFormat = logFormatOf(tf, opts)
+		src, err := newFilteredSource(tf, tf.logFormat, opts)
+		if err != nil {
+			return err
+		}
+		if err := printLines(os.Stdout, src, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	rootWidget := newUI(filepath)
-	ui, _ := tui.New(rootWidget)
+func main() {
+	opts, err := parseArgs(os.Args[1:], os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logviewer:", err)
+		os.Exit(2)
+	}
 
-	ui.SetKeybinding("Ctrl+C", func() { ui.Quit() })
-	ui.SetKeybinding("Esc", func() { ui.Quit() })
+	var inputs []io.ReadSeeker
+	for _, name := range opts.files {
+		rs, closer, err := openInput(name, os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "logviewer:", err)
+			os.Exit(1)
+		}
+		defer closer.Close()
+		inputs = append(inputs, rs)
+	}
 
-	ui.Run()
+	if opts.printMode {
+		err = runPrint(opts, inputs)
+	} else {
+		err = runUI(opts, inputs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "logviewer:", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+)
+
+// matchingLine is a line of the file which passed the filter
+type matchingLine struct {
+	index      uint
+	position   int64
+	isContext  bool // line did not pass the filter, but is near one which did
+	incomplete bool // unfinished last line of the file, it can still change
+}
+
+// completeMatches returns matching lines up to the first unfinished one, so
+// sources filtering them further do not keep lines which can still change
+func completeMatches(matches []matchingLine) []matchingLine {
+	for n, m := range matches {
+		if m.incomplete {
+			return matches[:n]
+		}
+	}
+	return matches
+}
+
+// searching is implemented by line sources which search the file in background
+type searching interface {
+	// progress returns number of bytes searched and to be searched
+	progress() (int64, int64, bool)
+	// wait blocks until the running search ends
+	wait()
+}
+
+// matchingLines is a lineSource of lines passing the filter. The file is
+// searched in background, rows appear as matching lines are found
+type matchingLines struct {
+	tf     *TextFile
+	filter func(FileLine) bool
+
+	mu            sync.Mutex
+	matches       []matchingLine
+	searchedLines uint  // number of lines already searched
+	searchedSize  int64 // position after the last searched line
+	searchedEnd   int64 // size of the file searched, with unfinished last line
+	searched      int64 // bytes searched by the running search
+	total         int64 // bytes to be searched by the running search
+	running       bool
+	completed     bool  // all lines up to the size of the file were searched
+	changed       bool  // matching lines were found since the last update
+	generation    int   // incremented when results of running search are obsolete
+	err           error // error of the last search, nil if it succeeded
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+func newMatchingLines(tf *TextFile, filter func(line FileLine) bool) *matchingLines {
+	result := &matchingLines{}
+	result.tf = tf
+	result.filter = filter
+	result.startSearch()
+	return result
+}
+
+// startSearch searches lines after the already searched ones. The search runs
+// in background if the file can be read concurrently
+func (ml *matchingLines) startSearch() {
+	ra, concurrent := ml.tf.rs.(io.ReaderAt)
+	if !concurrent {
+		ra = &seekingReaderAt{rs: ml.tf.rs}
+	}
+	size := ml.tf.size
+	// end of a decompressed file is found by the search, not to block the caller
+	sized, findSize := ml.tf.rs.(sizedLater)
+	findSize = findSize && !ml.tf.sizeKnown
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	ml.mu.Lock()
+	from := ml.searchedSize
+	fromLine := ml.searchedLines
+	// unfinished last line is searched again
+	for len(ml.matches) != 0 && ml.matches[len(ml.matches)-1].position >= from {
+		ml.matches = ml.matches[:len(ml.matches)-1]
+	}
+	matchesCount := len(ml.matches)
+	generation := ml.generation
+	ml.searched = 0
+	ml.total = size - from
+	ml.running = true
+	ml.cancel = cancel
+	ml.done = done
+	ml.mu.Unlock()
+
+	run := func() {
+		defer close(done)
+		var nextLine uint
+		var end int64
+		var err error
+		if findSize {
+			size, err = sized.readSize()
+			ml.mu.Lock()
+			if ml.generation == generation {
+				ml.total = size - from
+			}
+			ml.mu.Unlock()
+		}
+		if err == nil {
+			nextLine, end, err = searchFile(ctx, ra, ml.tf.enc, from, fromLine, size, ml.filter,
+				func(matches []matchingLine, searched int64) {
+					ml.mu.Lock()
+					defer ml.mu.Unlock()
+					if ml.generation != generation {
+						return
+					}
+					ml.matches = append(ml.matches, matches...)
+					ml.searched = searched
+					if len(matches) != 0 {
+						ml.changed = true
+					}
+				})
+		}
+
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		if ml.generation != generation {
+			return
+		}
+		if err != nil {
+			ml.matches = ml.matches[:matchesCount]
+			if err != context.Canceled {
+				ml.err = &ioError{"search", err}
+			}
+		} else {
+			ml.err = nil
+			ml.searchedLines = nextLine
+			ml.searchedSize = end
+			ml.searchedEnd = size
+			ml.changed = ml.changed || !ml.completed
+			ml.completed = true
+		}
+		ml.running = false
+	}
+
+	if concurrent {
+		go run()
+	} else {
+		run()
+	}
+}
+
+// stop cancels the running search and drops its results
+func (ml *matchingLines) stop() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	if ml.cancel != nil {
+		ml.cancel()
+	}
+	ml.generation++
+	ml.running = false
+}
+
+// wait blocks until the running search ends
+func (ml *matchingLines) wait() {
+	ml.mu.Lock()
+	done := ml.done
+	ml.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// progress returns number of bytes searched and to be searched by the
+// running search
+func (ml *matchingLines) progress() (int64, int64, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	return ml.searched, ml.total, ml.running
+}
+
+// matchesAt returns up to count matching lines found so far, starting at row
+// first
+func (ml *matchingLines) matchesAt(first uint, count uint) []matchingLine {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	var result []matchingLine
+	for row := first; row < first+count && row < uint(len(ml.matches)); row++ {
+		result = append(result, ml.matches[row])
+	}
+	return result
+}
+
+func (ml *matchingLines) lines(first uint, count uint) []FileLine {
+	var result []FileLine
+	for _, m := range ml.matchesAt(first, count) {
+		result = append(result, ml.tf.lineAt(m.position))
+	}
+	return result
+}
+
+// rowOfLine waits for the search, if the line was not reached yet
+func (ml *matchingLines) rowOfLine(lineIndex uint) uint {
+	find := func() (uint, bool) {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		row := sort.Search(len(ml.matches), func(i int) bool {
+			return ml.matches[i].index >= lineIndex
+		})
+		return uint(row), row < len(ml.matches) || !ml.running
+	}
+	row, found := find()
+	if !found {
+		ml.wait()
+		row, _ = find()
+	}
+	return row
+}
+
+// rowOfPosition returns the first row of a line at given position of the file
+// or after it. It waits for the search, if the position was not reached yet
+func (ml *matchingLines) rowOfPosition(position int64) uint {
+	find := func() (uint, bool) {
+		ml.mu.Lock()
+		defer ml.mu.Unlock()
+		row := sort.Search(len(ml.matches), func(i int) bool {
+			return ml.matches[i].position >= position
+		})
+		return uint(row), row < len(ml.matches) || !ml.running
+	}
+	row, found := find()
+	if !found {
+		ml.wait()
+		row, _ = find()
+	}
+	return row
+}
+
+// lastError returns error of searching or reading the file
+func (ml *matchingLines) lastError() error {
+	ml.mu.Lock()
+	err := ml.err
+	ml.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ml.tf.lastError()
+}
+
+func (ml *matchingLines) rowsCount() (uint, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	return uint(len(ml.matches)), ml.completed && !ml.running
+}
+
+// update searches lines appended to the file. If the file was truncated or
+// replaced, the search starts again from the first line. fileGrew is returned
+// also when the running search found new lines
+func (ml *matchingLines) update() fileChange {
+	change := ml.tf.update()
+	switch change {
+	case fileTruncated, fileRotated:
+		ml.stop()
+		ml.mu.Lock()
+		ml.matches = nil
+		ml.searchedLines = 0
+		ml.searchedSize = 0
+		ml.searchedEnd = 0
+		ml.completed = false
+		ml.mu.Unlock()
+		ml.startSearch()
+	}
+
+	ml.mu.Lock()
+	restart := !ml.running && ml.searchedEnd < ml.tf.size
+	changed := ml.changed
+	ml.changed = false
+	ml.mu.Unlock()
+
+	if restart {
+		ml.startSearch()
+	}
+	if change == fileUnchanged && changed {
+		change = fileGrew
+	}
+	return change
+}
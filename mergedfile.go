@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// mergeCheckpointInterval is number of merged lines between checkpoints of
+// the merge
+const mergeCheckpointInterval = 1024
+
+// mergeReadAhead is number of lines read from a source at once
+const mergeReadAhead = 64
+
+// mergeState is a position of the merge: index of the next merged line, index
+// of the next line of each source and time of the last line of each source
+type mergeState struct {
+	index uint
+	next  []uint
+	last  []time.Time
+}
+
+func (s mergeState) clone() mergeState {
+	result := s
+	result.next = append([]uint(nil), s.next...)
+	result.last = append([]time.Time(nil), s.last...)
+	return result
+}
+
+// timedLine is a line of a source with its time. Lines without a timestamp,
+// e.g. stack traces, have time of the previous line of the source
+type timedLine struct {
+	FileLine
+	time time.Time
+}
+
+// merger merges lines of the sources, starting at the state
+type merger struct {
+	mf    *mergedFile
+	state mergeState
+	heads [][]timedLine // lines of each source read ahead
+}
+
+// head returns the next line of the source
+func (m *merger) head(source int) (timedLine, bool) {
+	if len(m.heads[source]) == 0 {
+		last := m.state.last[source]
+		for _, line := range m.mf.sources[source].tf.lines(m.state.next[source], mergeReadAhead) {
+			if line.incomplete {
+				// time of the line is not known until it is finished
+				break
+			}
+			if t, ok := m.mf.sources[source].tf.timeOf(line); ok {
+				last = t
+			}
+			m.heads[source] = append(m.heads[source], timedLine{line, last})
+		}
+		if len(m.heads[source]) == 0 {
+			m.mf.exhausted(source, m.state.index)
+			return timedLine{}, false
+		}
+	}
+	return m.heads[source][0], true
+}
+
+// best returns source of the next merged line. Lines of the same time are
+// taken in order of the sources
+func (m *merger) best() (int, timedLine, bool) {
+	best := -1
+	var bestLine timedLine
+	for source := range m.heads {
+		line, ok := m.head(source)
+		if ok && (best < 0 || line.time.Before(bestLine.time)) {
+			best = source
+			bestLine = line
+		}
+	}
+	return best, bestLine, best >= 0
+}
+
+// next returns the next merged line
+func (m *merger) next() (FileLine, bool) {
+	source, line, ok := m.best()
+	if !ok {
+		m.mf.reachedEnd(m.state.index)
+		return FileLine{}, false
+	}
+	m.heads[source] = m.heads[source][1:]
+	m.state.next[source]++
+	m.state.last[source] = line.time
+	m.state.index++
+	m.mf.addCheckpoint(m.state)
+	line.source = source
+	return line.FileLine, true
+}
+
+// mergedSource is a file shown in the merged view
+type mergedSource struct {
+	name string
+	tf   *TextFile
+}
+
+// mergedFile interleaves lines of several files by their timestamps, keeping
+// up to cacheSize merged lines in CachedLines like TextFile does
+type mergedFile struct {
+	CachedLines       map[uint]FileLine
+	cacheSize         uint
+	startingLineIndex uint
+	sources           []mergedSource
+	checkpoints       []mergeState
+	exhaustedAt       map[int]uint // merged index where the source had no more lines
+	count             uint         // number of merged lines, if counted
+	counted           bool
+	tagWidth          int
+}
+
+func newMergedFile(sources []mergedSource, cacheSize uint) *mergedFile {
+	result := &mergedFile{}
+	result.cacheSize = cacheSize
+	result.sources = sources
+	for _, s := range sources {
+		if len(s.name) > result.tagWidth {
+			result.tagWidth = len(s.name)
+		}
+	}
+	result.reset()
+	result.goTo(0)
+	return result
+}
+
+// reset drops all checkpoints of the merge
+func (mf *mergedFile) reset() {
+	start := mergeState{}
+	start.next = make([]uint, len(mf.sources))
+	start.last = make([]time.Time, len(mf.sources))
+	mf.checkpoints = []mergeState{start}
+	mf.exhaustedAt = make(map[int]uint)
+	mf.counted = false
+}
+
+func (mf *mergedFile) addCheckpoint(s mergeState) {
+	if s.index%mergeCheckpointInterval == 0 && s.index > mf.checkpoints[len(mf.checkpoints)-1].index {
+		mf.checkpoints = append(mf.checkpoints, s.clone())
+	}
+}
+
+func (mf *mergedFile) exhausted(source int, index uint) {
+	if at, ok := mf.exhaustedAt[source]; !ok || index < at {
+		mf.exhaustedAt[source] = index
+	}
+}
+
+func (mf *mergedFile) reachedEnd(index uint) {
+	mf.count = index
+	mf.counted = true
+}
+
+// mergerAt returns merger starting at the last checkpoint for which the
+// condition holds
+func (mf *mergedFile) mergerAt(before func(s mergeState) bool) *merger {
+	n := sort.Search(len(mf.checkpoints), func(i int) bool {
+		return !before(mf.checkpoints[i])
+	})
+	if n > 0 {
+		n--
+	}
+	m := &merger{}
+	m.mf = mf
+	m.state = mf.checkpoints[n].clone()
+	m.heads = make([][]timedLine, len(mf.sources))
+	return m
+}
+
+func (mf *mergedFile) goTo(lineIndex uint) {
+	m := mf.mergerAt(func(s mergeState) bool { return s.index <= lineIndex })
+	for m.state.index < lineIndex {
+		if _, ok := m.next(); !ok {
+			break
+		}
+	}
+	mf.CachedLines = make(map[uint]FileLine)
+	mf.startingLineIndex = lineIndex
+	for m.state.index >= lineIndex && uint(len(mf.CachedLines)) < mf.cacheSize {
+		index := m.state.index
+		line, ok := m.next()
+		if !ok {
+			break
+		}
+		mf.CachedLines[index] = line
+	}
+}
+
+// lineOfTime returns index of the first merged line not before the time. The
+// merged lines before it are lines of all sources before the time, each source
+// is bisected
+func (mf *mergedFile) lineOfTime(t time.Time) uint {
+	var result uint
+	for _, s := range mf.sources {
+		result += s.tf.lineOfTime(t)
+	}
+	return result
+}
+
+func (mf *mergedFile) lines(first uint, count uint) []FileLine {
+	var result []FileLine
+	for uint(len(result)) < count {
+		next := first + uint(len(result))
+		mf.goTo(next)
+		if len(mf.CachedLines) == 0 {
+			break
+		}
+		for ; uint(len(result)) < count; next++ {
+			line, ok := mf.CachedLines[next]
+			if !ok {
+				break
+			}
+			result = append(result, line)
+		}
+		if uint(len(mf.CachedLines)) < mf.cacheSize {
+			break
+		}
+	}
+	return result
+}
+
+func (mf *mergedFile) rowOfLine(lineIndex uint) uint {
+	return lineIndex
+}
+
+// rowsCount is known once the merge reached end of all sources
+func (mf *mergedFile) rowsCount() (uint, bool) {
+	return mf.count, mf.counted
+}
+
+// update checks all sources. When a source grows, merged lines following its
+// former end may change, so the merge continues from a checkpoint before it.
+// If any source was truncated or replaced, the merge starts again
+func (mf *mergedFile) update() fileChange {
+	result := fileUnchanged
+	for source, s := range mf.sources {
+		switch change := s.tf.update(); change {
+		case fileTruncated, fileRotated:
+			result = change
+		case fileGrew:
+			if result == fileUnchanged {
+				result = fileGrew
+			}
+			if at, ok := mf.exhaustedAt[source]; ok {
+				n := sort.Search(len(mf.checkpoints), func(i int) bool {
+					return mf.checkpoints[i].index > at
+				})
+				mf.checkpoints = mf.checkpoints[:n]
+				delete(mf.exhaustedAt, source)
+			}
+			mf.counted = false
+		}
+	}
+	switch result {
+	case fileUnchanged:
+		return result
+	case fileTruncated, fileRotated:
+		mf.reset()
+		mf.goTo(0)
+	default:
+		mf.goTo(mf.startingLineIndex)
+	}
+	return result
+}
+
+// lastError returns error of reading any of the files
+func (mf *mergedFile) lastError() error {
+	for _, s := range mf.sources {
+		if err := s.tf.lastError(); err != nil {
+			return fmt.Errorf("%v: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// tag returns name of the source of the line, padded to the same width for all
+// sources
+func (mf *mergedFile) tag(line FileLine) string {
+	return fmt.Sprintf("[%-*v] ", mf.tagWidth, mf.sources[line.source].name)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMergedMocks(cacheSize uint, contents ...string) (*mergedFile, []*fileMock) {
+	var sources []mergedSource
+	var mocks []*fileMock
+	for n, c := range contents {
+		fm := newFileMock(c)
+		mocks = append(mocks, fm)
+		sources = append(sources, mergedSource{fmt.Sprintf("f%v", n), NewTextFile(fm, 3)})
+	}
+	return newMergedFile(sources, cacheSize), mocks
+}
+
+func taggedLines(mf *mergedFile, first uint, count uint) []string {
+	var result []string
+	for _, line := range mf.lines(first, count) {
+		result = append(result, mf.tag(line)+line.Contents)
+	}
+	return result
+}
+
+func TestMergingFiles(t *testing.T) {
+	mf, _ := newMergedMocks(2,
+		"2019-11-25T10:00:01Z app start\n2019-11-25T10:00:03Z app request\n  at stack\n2019-11-25T10:00:05Z app end\n",
+		"[2019-11-25 10:00:02] nginx GET\n[2019-11-25 10:00:03] nginx POST\n",
+		"2019-11-25 11:00:00.5+01:00 db query\n")
+
+	expected := []string{
+		"[f2] 2019-11-25 11:00:00.5+01:00 db query",
+		"[f0] 2019-11-25T10:00:01Z app start",
+		"[f1] [2019-11-25 10:00:02] nginx GET",
+		"[f0] 2019-11-25T10:00:03Z app request",
+		"[f0]   at stack",
+		"[f1] [2019-11-25 10:00:03] nginx POST",
+		"[f0] 2019-11-25T10:00:05Z app end",
+	}
+	if observed := taggedLines(mf, 0, 100); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q\nhave: %q", expected, observed)
+	}
+	if count, known := mf.rowsCount(); !known || count != 7 {
+		t.Errorf("rowsCount() want: 7 true, have: %v %v", count, known)
+	}
+
+	mf.goTo(3)
+	if len(mf.CachedLines) != 2 || mf.CachedLines[4].Contents != "  at stack" || mf.CachedLines[4].source != 0 {
+		t.Errorf("goTo(3) cached lines: %v", mf.CachedLines)
+	}
+
+	timeCases := []struct {
+		time     string
+		expected uint
+	}{
+		{"2019-11-25T09:00:00Z", 0},
+		{"2019-11-25T10:00:02Z", 2},
+		{"2019-11-25T10:00:02.5Z", 3},
+		{"2019-11-25T10:00:04Z", 6},
+		{"2019-11-25T12:00:00Z", 7},
+	}
+	for _, c := range timeCases {
+		at, _ := time.Parse(time.RFC3339, c.time)
+		if observed := mf.lineOfTime(at); observed != c.expected {
+			t.Errorf("lineOfTime(%v) want: %v, have: %v", c.time, c.expected, observed)
+		}
+	}
+}
+
+func TestGoingToMergedLines(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&a, "2019-11-25T10:%02d:%02d.%03dZ a%v\n", i/3600, i/60%60, i%60*10, i)
+		fmt.Fprintf(&b, "2019-11-25T10:%02d:%02d.%03dZ b%v\n", i/3600, i/60%60, i%60*10+5, i)
+	}
+	mf, _ := newMergedMocks(10, a.String(), b.String())
+	all := taggedLines(mf, 0, 5000)
+	if len(all) != 4000 {
+		t.Fatalf("merged lines count want: 4000, have: %v", len(all))
+	}
+	if len(mf.checkpoints) != 4 {
+		t.Errorf("checkpoints count want: 4, have: %v", len(mf.checkpoints))
+	}
+	for _, first := range []uint{3999, 2048, 1023, 1024, 5, 3000, 0} {
+		if observed := taggedLines(mf, first, 3); !reflect.DeepEqual(observed, all[first:first+uint(len(observed))]) || len(observed) == 0 {
+			t.Errorf("lines(%v, 3) want: %q, have: %q", first, all[first:], observed)
+		}
+	}
+	if all[1] != "[f1] 2019-11-25T10:00:00.005Z b0" || all[2] != "[f0] 2019-11-25T10:00:00.010Z a1" {
+		t.Errorf("lines are not interleaved: %q", all[:3])
+	}
+	for _, index := range []uint{0, 1, 1023, 2500, 3999} {
+		at, _ := time.Parse(time.RFC3339, strings.Fields(all[index])[1])
+		if observed := mf.lineOfTime(at); observed != index {
+			t.Errorf("lineOfTime(%v) want: %v, have: %v", at, index, observed)
+		}
+	}
+}
+
+func TestMergingGrowingFiles(t *testing.T) {
+	mf, mocks := newMergedMocks(10,
+		"2019-11-25T10:00:01Z a1\n",
+		"2019-11-25T10:00:02Z b2\n2019-11-25T10:00:04Z b4\n")
+	taggedLines(mf, 0, 10)
+
+	mocks[0].contents += "2019-11-25T10:00:03Z a3\n"
+	if change := mf.update(); change != fileGrew {
+		t.Errorf("update() of grown file want: %v, have: %v", fileGrew, change)
+	}
+	expected := []string{
+		"[f0] 2019-11-25T10:00:01Z a1",
+		"[f1] 2019-11-25T10:00:02Z b2",
+		"[f0] 2019-11-25T10:00:03Z a3",
+		"[f1] 2019-11-25T10:00:04Z b4",
+	}
+	if observed := taggedLines(mf, 0, 10); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q\nhave: %q", expected, observed)
+	}
+
+	mocks[1].contents = "2019-11-25T10:00:00Z b0\n"
+	if change := mf.update(); change != fileTruncated {
+		t.Errorf("update() of truncated file want: %v, have: %v", fileTruncated, change)
+	}
+	expected = []string{
+		"[f1] 2019-11-25T10:00:00Z b0",
+		"[f0] 2019-11-25T10:00:01Z a1",
+		"[f0] 2019-11-25T10:00:03Z a3",
+	}
+	if observed := taggedLines(mf, 0, 10); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q\nhave: %q", expected, observed)
+	}
+}
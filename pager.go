@@ -0,0 +1,255 @@
+package main
+
+import "time"
+
+// marginLinesCount is number of lines read after the visible ones, so pager
+// knows if it can scroll down
+const marginLinesCount = 1
+
+// lineSource gives access to consecutive rows of lines, e.g. all lines of a
+// file or only the ones matching a filter
+type lineSource interface {
+	// lines returns up to count lines starting at row first
+	lines(first uint, count uint) []FileLine
+	// rowOfLine returns first row showing line of given index or a later one
+	rowOfLine(lineIndex uint) uint
+}
+
+// updatable is implemented by line sources of files which can grow
+type updatable interface {
+	update() fileChange
+}
+
+// countable is implemented by line sources which can know number of their rows
+type countable interface {
+	// rowsCount returns number of rows, if it is known already
+	rowsCount() (uint, bool)
+}
+
+// timed is implemented by line sources, whose lines can be found by their
+// timestamps
+type timed interface {
+	// lineOfTime returns index of the first line with a timestamp not before t
+	lineOfTime(t time.Time) uint
+}
+
+// pager shows a window of visibleCount rows of a lineSource. Wrapped lines
+// can take more rows of the screen, then fewer of them are visible
+type pager struct {
+	src          lineSource
+	first        uint
+	visibleCount uint
+	window       []FileLine
+	following    bool                // keep showing the last rows, when new ones appear
+	lineRows     func(FileLine) uint // rows of the screen taken by the line, nil if each takes one
+}
+
+func newPager(src lineSource, visibleCount uint) *pager {
+	result := &pager{}
+	result.src = src
+	result.visibleCount = visibleCount
+	result.goTo(0)
+	return result
+}
+
+// setSource shows rows of another source, starting from the first one or the
+// last ones when following
+func (p *pager) setSource(src lineSource) {
+	p.src = src
+	p.goTo(0)
+	if p.following {
+		p.end()
+	}
+}
+
+func (p *pager) goTo(first uint) {
+	p.first = first
+	p.window = p.src.lines(first, p.visibleCount+marginLinesCount)
+}
+
+func (p *pager) firstLine() uint {
+	return p.first
+}
+
+// goToLine moves the window to the row showing given line of the file
+func (p *pager) goToLine(lineIndex uint) {
+	p.goTo(p.src.rowOfLine(lineIndex))
+	if uint(len(p.window)) < p.visibleCount {
+		p.end()
+	}
+}
+
+// hasMoreLines tells if there are lines below the visible window
+func (p *pager) hasMoreLines() bool {
+	return uint(len(p.window)) > p.visibleCount
+}
+
+// shownRows returns number of rows of the screen taken by visible lines
+func (p *pager) shownRows() uint {
+	lines := p.visibleLines()
+	if p.lineRows == nil {
+		return uint(len(lines))
+	}
+	var result uint
+	for _, line := range lines {
+		result += p.lineRows(line)
+	}
+	return result
+}
+
+// fittingCount returns number of the first visible lines which fit on the
+// screen, at least one
+func (p *pager) fittingCount() uint {
+	if p.lineRows == nil {
+		return p.visibleCount
+	}
+	var rows, count uint
+	for _, line := range p.visibleLines() {
+		rows += p.lineRows(line)
+		if rows > p.visibleCount {
+			break
+		}
+		count++
+	}
+	if count == 0 {
+		return 1
+	}
+	return count
+}
+
+func (p *pager) scrollUp(count uint) {
+	if count > p.first {
+		count = p.first
+	}
+	if count == 0 {
+		return
+	}
+	p.goTo(p.first - count)
+}
+
+func (p *pager) scrollDown(count uint) {
+	if count == 0 || !p.hasMoreLines() && p.shownRows() <= p.visibleCount {
+		return
+	}
+	p.goTo(p.first + count)
+	if p.shownRows() < p.visibleCount {
+		p.end()
+	}
+}
+
+// nextRecord scrolls to the next row starting a record
+func (p *pager) nextRecord(start func(FileLine) bool) {
+	for n, line := range p.src.lines(p.first+1, maxRecordLines) {
+		if start(line) {
+			p.goTo(p.first + 1 + uint(n))
+			if uint(len(p.window)) < p.visibleCount {
+				p.end()
+			}
+			return
+		}
+	}
+}
+
+// previousRecord scrolls to the closest row starting a record above the first
+// visible one
+func (p *pager) previousRecord(start func(FileLine) bool) {
+	from := uint(0)
+	if p.first > maxRecordLines {
+		from = p.first - maxRecordLines
+	}
+	lines := p.src.lines(from, p.first-from)
+	for n := len(lines) - 1; n >= 0; n-- {
+		if start(lines[n]) {
+			p.goTo(from + uint(n))
+			return
+		}
+	}
+}
+
+// pageUp scrolls up by lines fitting on the screen above the first one
+func (p *pager) pageUp() {
+	if p.lineRows == nil {
+		p.scrollUp(p.visibleCount)
+		return
+	}
+	from := uint(0)
+	if p.first > p.visibleCount {
+		from = p.first - p.visibleCount
+	}
+	lines := p.src.lines(from, p.first-from)
+	var rows, count uint
+	for n := len(lines) - 1; n >= 0; n-- {
+		rows += p.lineRows(lines[n])
+		if rows > p.visibleCount && count != 0 {
+			break
+		}
+		count++
+	}
+	p.scrollUp(count)
+}
+
+// pageDown scrolls down by lines fitting on the screen
+func (p *pager) pageDown() {
+	p.scrollDown(p.fittingCount())
+}
+
+func (p *pager) home() {
+	p.goTo(0)
+}
+
+// end moves the window so the last row is at its bottom
+func (p *pager) end() {
+	if c, ok := p.src.(countable); ok {
+		if count, known := c.rowsCount(); known && count > p.first+uint(len(p.window)) {
+			p.goTo(count - 1)
+		}
+	}
+	if len(p.window) == 0 {
+		p.goTo(0)
+	}
+	for p.hasMoreLines() {
+		p.goTo(p.first + uint(len(p.window)) - 1)
+	}
+	rowsCount := p.first + uint(len(p.window))
+	if rowsCount < p.visibleCount {
+		p.goTo(0)
+	} else {
+		p.goTo(rowsCount - p.visibleCount)
+	}
+	// the last line is at the bottom of the screen, when lines are wrapped
+	for p.shownRows() > p.visibleCount && len(p.window) > 1 {
+		p.goTo(p.first + 1)
+	}
+}
+
+// update reads lines appended to the file. If the window showed the last rows
+// while following, it is moved so the new ones are visible. If the file was
+// truncated or replaced, the window is moved to its start
+func (p *pager) update() fileChange {
+	u, ok := p.src.(updatable)
+	if !ok {
+		return fileUnchanged
+	}
+	atEnd := !p.hasMoreLines()
+	change := u.update()
+	switch change {
+	case fileUnchanged:
+		return change
+	case fileTruncated, fileRotated:
+		p.goTo(0)
+	default:
+		p.goTo(p.first)
+	}
+	if atEnd && p.following {
+		p.end()
+	}
+	return change
+}
+
+// visibleLines returns lines of the window in order
+func (p *pager) visibleLines() []FileLine {
+	if uint(len(p.window)) > p.visibleCount {
+		return p.window[:p.visibleCount]
+	}
+	return p.window
+}
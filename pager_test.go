@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type pagerTestCase struct {
+	action        func(p *pager)
+	expectedFirst uint
+	expectedLines []string
+}
+
+func performPagerTests(t *testing.T, p *pager, testCases []pagerTestCase) {
+	for n, c := range testCases {
+		c.action(p)
+		if p.firstLine() != c.expectedFirst {
+			t.Errorf("Case %v: firstLine() want: %v, have: %v", n, c.expectedFirst, p.firstLine())
+		}
+		var contents []string
+		for _, l := range p.visibleLines() {
+			contents = append(contents, l.Contents)
+		}
+		if !reflect.DeepEqual(contents, c.expectedLines) {
+			t.Errorf("Case %v: visibleLines() want: %v, have: %v", n, c.expectedLines, contents)
+		}
+	}
+}
+
+func TestPagerScrolling(t *testing.T) {
+	p := newPager(NewTextFile(newFileMock("0\n1\n2\n3\n4\n5\n6\n"), 4), 3)
+	testCases := []pagerTestCase{
+		{func(p *pager) {}, 0, []string{"0", "1", "2"}},
+		{func(p *pager) { p.scrollDown(1) }, 1, []string{"1", "2", "3"}},
+		{func(p *pager) { p.pageDown() }, 4, []string{"4", "5", "6"}},
+		{func(p *pager) { p.scrollDown(1) }, 4, []string{"4", "5", "6"}},
+		{func(p *pager) { p.scrollUp(1) }, 3, []string{"3", "4", "5"}},
+		{func(p *pager) { p.pageUp() }, 0, []string{"0", "1", "2"}},
+		{func(p *pager) { p.scrollUp(1) }, 0, []string{"0", "1", "2"}},
+		{func(p *pager) { p.scrollDown(3) }, 3, []string{"3", "4", "5"}},
+		{func(p *pager) { p.scrollDown(10) }, 4, []string{"4", "5", "6"}},
+		{func(p *pager) { p.home() }, 0, []string{"0", "1", "2"}},
+		{func(p *pager) { p.end() }, 4, []string{"4", "5", "6"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerShortFile(t *testing.T) {
+	p := newPager(NewTextFile(newFileMock("0\n1\n"), 4), 3)
+	testCases := []pagerTestCase{
+		{func(p *pager) {}, 0, []string{"0", "1"}},
+		{func(p *pager) { p.pageDown() }, 0, []string{"0", "1"}},
+		{func(p *pager) { p.end() }, 0, []string{"0", "1"}},
+		{func(p *pager) { p.pageUp() }, 0, []string{"0", "1"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerEmptyFile(t *testing.T) {
+	p := newPager(NewTextFile(createEmptyFile(), 4), 3)
+	testCases := []pagerTestCase{
+		{func(p *pager) {}, 0, nil},
+		{func(p *pager) { p.end() }, 0, nil},
+		{func(p *pager) { p.scrollDown(1) }, 0, nil},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerWrappedLines(t *testing.T) {
+	p := newPager(NewTextFile(newFileMock("a\nbbb\ncc\nd\ne\n"), 10), 3)
+	// each character takes a row
+	p.lineRows = func(line FileLine) uint { return uint(len(line.Contents)) }
+	testCases := []pagerTestCase{
+		{func(p *pager) {}, 0, []string{"a", "bbb", "cc"}},
+		{func(p *pager) { p.pageDown() }, 1, []string{"bbb", "cc", "d"}},
+		{func(p *pager) { p.pageDown() }, 2, []string{"cc", "d", "e"}},
+		{func(p *pager) { p.pageDown() }, 3, []string{"d", "e"}},
+		{func(p *pager) { p.scrollDown(1) }, 3, []string{"d", "e"}},
+		{func(p *pager) { p.pageUp() }, 2, []string{"cc", "d", "e"}},
+		{func(p *pager) { p.pageUp() }, 1, []string{"bbb", "cc", "d"}},
+		{func(p *pager) { p.pageUp() }, 0, []string{"a", "bbb", "cc"}},
+		{func(p *pager) { p.end() }, 3, []string{"d", "e"}},
+		{func(p *pager) { p.home() }, 0, []string{"a", "bbb", "cc"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerMatchingLines(t *testing.T) {
+	tf := NewTextFile(newFileMock("a0\nb1\na2\nb3\na4\na5\nb6\na7\n"), 2)
+	ml := newMatchingLines(tf, substringFilter("a"))
+	ml.wait()
+	p := newPager(ml, 2)
+	testCases := []pagerTestCase{
+		{func(p *pager) {}, 0, []string{"a0", "a2"}},
+		{func(p *pager) { p.scrollDown(1) }, 1, []string{"a2", "a4"}},
+		{func(p *pager) { p.end() }, 3, []string{"a5", "a7"}},
+		{func(p *pager) { p.scrollUp(1) }, 2, []string{"a4", "a5"}},
+		{func(p *pager) { p.goToLine(3) }, 2, []string{"a4", "a5"}},
+		{func(p *pager) { p.goToLine(7) }, 3, []string{"a5", "a7"}},
+		{func(p *pager) { p.home() }, 0, []string{"a0", "a2"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerFollowingGrowingFile(t *testing.T) {
+	fm := newFileMock("0\n1\n")
+	p := newPager(NewTextFile(fm, 3), 2)
+	p.following = true
+	grow := func(text string) func(p *pager) {
+		return func(p *pager) {
+			fm.contents += text
+			p.update()
+		}
+	}
+	testCases := []pagerTestCase{
+		{grow(""), 0, []string{"0", "1"}},
+		{grow("2\n"), 1, []string{"1", "2"}},
+		{grow("3\n4\n"), 3, []string{"3", "4"}},
+		{func(p *pager) { p.scrollUp(1) }, 2, []string{"2", "3"}},
+		{grow("5\n"), 2, []string{"2", "3"}},
+		{func(p *pager) { p.end() }, 4, []string{"4", "5"}},
+		{grow("6\n"), 5, []string{"5", "6"}},
+		// unfinished line is shown and replaced, when it is finished
+		{grow("7"), 6, []string{"6", "7"}},
+		{grow("7"), 6, []string{"6", "77"}},
+		{grow("\n8\n"), 7, []string{"77", "8"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerFollowingMatchingLines(t *testing.T) {
+	fm := newFileMock("a0\nb1\n")
+	ml := newMatchingLines(NewTextFile(fm, 2), substringFilter("a"))
+	ml.wait()
+	p := newPager(ml, 2)
+	p.following = true
+	grow := func(text string) func(p *pager) {
+		return func(p *pager) {
+			fm.contents += text
+			p.update()
+			ml.wait()
+			p.update()
+		}
+	}
+	testCases := []pagerTestCase{
+		{grow(""), 0, []string{"a0"}},
+		{grow("a2\nb3\n"), 0, []string{"a0", "a2"}},
+		{grow("a4\n"), 1, []string{"a2", "a4"}},
+		{grow("a5"), 2, []string{"a4", "a5"}},
+		{grow("x\n"), 2, []string{"a4", "a5x"}},
+		{grow("b6\na7\n"), 3, []string{"a5x", "a7"}},
+	}
+	performPagerTests(t, p, testCases)
+}
+
+func TestPagerRecords(t *testing.T) {
+	p := newPager(NewTextFile(newFileMock("r0\n 1\n 2\nr3\nr4\n 5\n 6\n 7\n"), 4), 3)
+	start := func(line FileLine) bool { return line.Contents[0] == 'r' }
+	testCases := []pagerTestCase{
+		{func(p *pager) { p.nextRecord(start) }, 3, []string{"r3", "r4", " 5"}},
+		{func(p *pager) { p.scrollDown(1) }, 4, []string{"r4", " 5", " 6"}},
+		{func(p *pager) { p.previousRecord(start) }, 3, []string{"r3", "r4", " 5"}},
+		{func(p *pager) { p.nextRecord(start) }, 4, []string{"r4", " 5", " 6"}},
+		{func(p *pager) { p.nextRecord(start) }, 4, []string{"r4", " 5", " 6"}},
+		{func(p *pager) { p.previousRecord(start) }, 3, []string{"r3", "r4", " 5"}},
+		{func(p *pager) { p.scrollUp(2) }, 1, []string{" 1", " 2", "r3"}},
+		{func(p *pager) { p.previousRecord(start) }, 0, []string{"r0", " 1", " 2"}},
+		{func(p *pager) { p.previousRecord(start) }, 0, []string{"r0", " 1", " 2"}},
+	}
+	performPagerTests(t, p, testCases)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxRecordLines is the most lines grouped into one record, so a file without
+// record starts is not read into memory whole
+const maxRecordLines = 1000
+
+// recordStartTimestamp and recordStartIndent are names of record start
+// patterns, other patterns are regexps
+const (
+	recordStartTimestamp = "timestamp"
+	recordStartIndent    = "indent"
+)
+
+// newRecordStart returns function telling if the line starts a record, like a
+// line with a timestamp followed by lines of a stack trace. The pattern is
+// "timestamp", "indent" for lines not starting with a whitespace, or a
+// regexp in slashes
+func newRecordStart(pattern string, tf *TextFile) (func(FileLine) bool, error) {
+	switch {
+	case pattern == recordStartTimestamp:
+		return func(line FileLine) bool {
+			_, ok := tf.timeOf(line)
+			return ok
+		}, nil
+	case pattern == recordStartIndent:
+		return func(line FileLine) bool {
+			return line.Contents != "" && !strings.ContainsAny(line.Contents[:1], " \t")
+		}, nil
+	case len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/"):
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return func(line FileLine) bool {
+			return re.MatchString(line.Contents)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown record start %q", pattern)
+}
+
+// recordLines is a matchSource of lines of records passing the filter. A
+// record is a line starting it with following lines, which do not. The
+// filter gets contents of the whole record, lines joined by "\n". Rows of the
+// input are grouped lazily, when they are needed
+type recordLines struct {
+	tf       *TextFile
+	input    matchSource
+	start    func(FileLine) bool
+	filter   func(FileLine) bool
+	matches  []matchingLine
+	consumed uint // number of input rows already grouped
+
+	// the last record, it may continue in lines not read yet
+	record        []matchingLine
+	contents      []string
+	recordShown   int // number of rows of the record already in matches
+	recordChecked int // number of rows of the record, when the filter was checked
+}
+
+func newRecordLines(tf *TextFile, input matchSource, start func(FileLine) bool, filter func(FileLine) bool) *recordLines {
+	result := &recordLines{}
+	result.tf = tf
+	result.input = input
+	result.start = start
+	result.filter = filter
+	return result
+}
+
+// checkRecord adds rows of the record to matches, if the record passes the
+// filter. Rows appended to a shown record are shown too
+func (rl *recordLines) checkRecord() {
+	if rl.recordChecked == len(rl.record) {
+		return
+	}
+	rl.recordChecked = len(rl.record)
+	if rl.recordShown == 0 {
+		line := FileLine{Contents: strings.Join(rl.contents, "\n"), position: rl.record[0].position}
+		if !rl.filter(line) {
+			return
+		}
+	}
+	rl.matches = append(rl.matches, rl.record[rl.recordShown:]...)
+	rl.recordShown = len(rl.record)
+}
+
+// checkMore groups next batch of input rows. It returns false if there is
+// nothing more to check at the moment
+func (rl *recordLines) checkMore() bool {
+	batch := completeMatches(rl.input.matchesAt(rl.consumed, narrowBatchSize))
+	lines := rl.input.lines(rl.consumed, uint(len(batch)))
+	if len(lines) < len(batch) {
+		// the file was truncated or reading failed, the rest is grouped after
+		// an update
+		batch = batch[:len(lines)]
+	}
+	for n, m := range batch {
+		if len(rl.record) != 0 {
+			last := rl.record[len(rl.record)-1]
+			if m.index != last.index+1 || len(rl.record) == maxRecordLines || rl.start(lines[n]) {
+				rl.checkRecord()
+				rl.record = nil
+				rl.contents = nil
+				rl.recordShown = 0
+				rl.recordChecked = 0
+			}
+		}
+		rl.record = append(rl.record, m)
+		rl.contents = append(rl.contents, lines[n].Contents)
+	}
+	rl.consumed += uint(len(batch))
+	if len(batch) == 0 {
+		matchesCount := len(rl.matches)
+		rl.checkRecord()
+		return len(rl.matches) != matchesCount
+	}
+	return true
+}
+
+func (rl *recordLines) matchesAt(first uint, count uint) []matchingLine {
+	for uint(len(rl.matches)) < first+count && rl.checkMore() {
+	}
+	var result []matchingLine
+	for row := first; row < first+count && row < uint(len(rl.matches)); row++ {
+		result = append(result, rl.matches[row])
+	}
+	return result
+}
+
+func (rl *recordLines) lines(first uint, count uint) []FileLine {
+	var result []FileLine
+	for _, m := range rl.matchesAt(first, count) {
+		result = append(result, rl.tf.lineAt(m.position))
+	}
+	return result
+}
+
+func (rl *recordLines) rowOfLine(lineIndex uint) uint {
+	for {
+		row := sort.Search(len(rl.matches), func(i int) bool {
+			return rl.matches[i].index >= lineIndex
+		})
+		if row < len(rl.matches) || !rl.checkMore() {
+			return uint(row)
+		}
+	}
+}
+
+func (rl *recordLines) rowsCount() (uint, bool) {
+	count, known := rl.input.rowsCount()
+	if !known || rl.consumed != count || rl.recordChecked != len(rl.record) {
+		return 0, false
+	}
+	return uint(len(rl.matches)), true
+}
+
+// update passes changes of the input. If the file was truncated or replaced,
+// its rows are grouped again
+func (rl *recordLines) update() fileChange {
+	change := rl.input.update()
+	if change == fileTruncated || change == fileRotated {
+		rl.matches = nil
+		rl.consumed = 0
+		rl.record = nil
+		rl.contents = nil
+		rl.recordShown = 0
+		rl.recordChecked = 0
+	}
+	return change
+}
+
+func (rl *recordLines) progress() (int64, int64, bool) {
+	if s, ok := rl.input.(searching); ok {
+		return s.progress()
+	}
+	return 0, 0, false
+}
+
+func (rl *recordLines) wait() {
+	if s, ok := rl.input.(searching); ok {
+		s.wait()
+	}
+}
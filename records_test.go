@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const recordsContents = "2019-11-25 10:00:01 INFO started\n" +
+	"2019-11-25 10:00:02 ERROR request failed\n" +
+	"java.lang.NullPointerException: name\n" +
+	"\tat com.example.Handler.handle(Handler.java:42)\n" +
+	"\tat com.example.Server.run(Server.java:7)\n" +
+	"2019-11-25 10:00:03 WARN slow request\n" +
+	"2019-11-25 10:00:04 ERROR request failed\n" +
+	"java.lang.IllegalStateException: closed\n" +
+	"\tat com.example.Pool.get(Pool.java:9)\n"
+
+func TestFilteringRecords(t *testing.T) {
+	testCases := []struct {
+		start    string
+		filters  []string
+		expected []string
+	}{
+		{
+			start:   recordStartTimestamp,
+			filters: []string{"NullPointerException"},
+			expected: []string{
+				"2019-11-25 10:00:02 ERROR request failed",
+				"java.lang.NullPointerException: name",
+				"\tat com.example.Handler.handle(Handler.java:42)",
+				"\tat com.example.Server.run(Server.java:7)"}},
+		{
+			start:   recordStartTimestamp,
+			filters: []string{"ERROR", "Pool.java"},
+			expected: []string{
+				"2019-11-25 10:00:04 ERROR request failed",
+				"java.lang.IllegalStateException: closed",
+				"\tat com.example.Pool.get(Pool.java:9)"}},
+		{
+			start:   recordStartTimestamp,
+			filters: []string{"not Exception"},
+			expected: []string{
+				"2019-11-25 10:00:01 INFO started",
+				"2019-11-25 10:00:03 WARN slow request"}},
+		{
+			start:   recordStartIndent,
+			filters: []string{"Handler"},
+			expected: []string{
+				"java.lang.NullPointerException: name",
+				"\tat com.example.Handler.handle(Handler.java:42)",
+				"\tat com.example.Server.run(Server.java:7)"}},
+		{
+			start:   "/^java/",
+			filters: []string{"Server"},
+			expected: []string{
+				"java.lang.NullPointerException: name",
+				"\tat com.example.Handler.handle(Handler.java:42)",
+				"\tat com.example.Server.run(Server.java:7)",
+				"2019-11-25 10:00:03 WARN slow request",
+				"2019-11-25 10:00:04 ERROR request failed"}},
+	}
+
+	for n, c := range testCases {
+		tf := NewTextFile(newFileMock(recordsContents), 3)
+		fs := newFilterStack(tf, plainTextField)
+		start, err := newRecordStart(c.start, tf)
+		if err != nil {
+			t.Errorf("Case %v: newRecordStart() failed: %v", n, err)
+			continue
+		}
+		fs.setRecords(start)
+		for _, expression := range c.filters {
+			fs.push(expression)
+		}
+		if observed := stackContents(fs); !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+}
+
+func TestInvalidRecordStart(t *testing.T) {
+	for n, pattern := range []string{"", "lines", "/(/", "/"} {
+		if _, err := newRecordStart(pattern, nil); err == nil {
+			t.Errorf("Case %v: newRecordStart(%q) want: error, have: nil", n, pattern)
+		}
+	}
+}
+
+func TestFilteringRecordsOfGrowingFile(t *testing.T) {
+	fm := newFileMock("2019-11-25 10:00:01 request failed\n\tat a\n")
+	tf := NewTextFile(fm, 3)
+	start, _ := newRecordStart(recordStartTimestamp, tf)
+	rl := newRecordLines(tf, tf, start, substringFilter("at b"))
+	if observed := rl.lines(0, 10); len(observed) != 0 {
+		t.Errorf("want: no lines, have: %v", observed)
+	}
+
+	fm.contents += "\tat b\n2019-11-25 10:00:02 done\n"
+	if change := rl.update(); change != fileGrew {
+		t.Errorf("update() want: %v, have: %v", fileGrew, change)
+	}
+	expected := []string{"2019-11-25 10:00:01 request failed", "\tat a", "\tat b"}
+	var observed []string
+	for _, line := range rl.lines(0, 10) {
+		observed = append(observed, line.Contents)
+	}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+
+	fm.contents += "\tat c\n"
+	rl.update()
+	if observed := rl.lines(3, 10); len(observed) != 0 {
+		t.Errorf("lines appended to not matching record want: none, have: %v", observed)
+	}
+}
+
+func TestFilteredFileOfRecords(t *testing.T) {
+	fm := newFileMock(recordsContents)
+	ff := newFilteredFile(fm, 10, substringFilter("IllegalState"))
+	start, _ := newRecordStart(recordStartTimestamp, ff.tf)
+	ff.setRecords(start)
+	expected := map[uint]filteredLine{6: {239, false}, 7: {280, false}, 8: {320, false}}
+	if !reflect.DeepEqual(ff.Lines, expected) {
+		t.Errorf("want: %v, have: %v", expected, ff.Lines)
+	}
+}
+
+// truncatedFile is a matchSource of lines of the file, which is truncated
+// after its rows are found
+type truncatedFile struct {
+	*TextFile
+	fm   *fileMock
+	size int
+}
+
+func (tr *truncatedFile) matchesAt(first uint, count uint) []matchingLine {
+	result := tr.TextFile.matchesAt(first, count)
+	tr.fm.contents = tr.fm.contents[:tr.size]
+	return result
+}
+
+func TestFilteringRecordsOfTruncatedFile(t *testing.T) {
+	fm := newFileMock(recordsContents)
+	tf := NewTextFile(fm, 3)
+	start, _ := newRecordStart(recordStartTimestamp, tf)
+	input := &truncatedFile{tf, fm, len("2019-11-25 10:00:01 INFO started\n")}
+	rl := newRecordLines(tf, input, start, substringFilter("INFO"))
+	if observed := rl.lines(0, 10); len(observed) != 0 {
+		t.Errorf("lines of truncated file want: none, have: %v", observed)
+	}
+
+	if change := rl.update(); change != fileTruncated {
+		t.Errorf("update() want: %v, have: %v", fileTruncated, change)
+	}
+	expected := []string{"2019-11-25 10:00:01 INFO started"}
+	var observed []string
+	for _, line := range rl.lines(0, 10) {
+		observed = append(observed, line.Contents)
+	}
+	if !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/marcusolsson/tui-go"
+)
+
+// defaultTabWidth is distance of tab stops
+const defaultTabWidth = 8
+
+// ansiColors are names of colors of ANSI escape codes, in order of their
+// numbers
+var ansiColors = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// textRenderer turns text of lines into spans which are safe to show in the
+// terminal
+type textRenderer struct {
+	showColors bool // colors of ANSI escape codes are shown, otherwise the codes are stripped
+	tabWidth   int
+}
+
+func newTextRenderer(showColors bool, tabWidth int) *textRenderer {
+	result := &textRenderer{}
+	result.showColors = showColors
+	result.tabWidth = tabWidth
+	return result
+}
+
+// spans returns spans of the text shown in the view. Text without a style
+// given by ANSI escape codes has its tokens highlighted, matches of the
+// searched pattern are highlighted everywhere, if it is not nil
+func (tr *textRenderer) spans(text string, search *regexp.Regexp) []highlightSpan {
+	var result []highlightSpan
+	column := 0
+	for _, part := range tr.ansiSpans(text) {
+		var visible []highlightSpan
+		visible, column = tr.visibleText(part.text, column)
+		for _, span := range visible {
+			if span.style != "" {
+				result = append(result, span)
+			} else {
+				result = append(result, highlightText(span.text, part.style, search)...)
+			}
+		}
+	}
+	if len(result) == 0 {
+		result = []highlightSpan{{"", ""}}
+	}
+	return result
+}
+
+// highlightText returns spans of the text in given style, with matches of the
+// searched pattern highlighted. Tokens are highlighted in text without a style
+func highlightText(text string, style string, search *regexp.Regexp) []highlightSpan {
+	switch {
+	case style == "" && search != nil:
+		return highlightSearch(text, search)
+	case style == "":
+		return highlightTokens(text)
+	case search == nil:
+		return []highlightSpan{{text, style}}
+	}
+	spans := highlightSearch(text, search)
+	for n := range spans {
+		if spans[n].style != "search" {
+			spans[n].style = style
+		}
+	}
+	return spans
+}
+
+// ansiSpans splits the text into spans between ANSI escape sequences, which
+// are removed. Spans are in styles set by SGR sequences, if colors are shown.
+// Unfinished sequences are kept, so their escape character is shown
+func (tr *textRenderer) ansiSpans(text string) []highlightSpan {
+	var result []highlightSpan
+	var style ansiStyle
+	last := 0
+	for i := 0; i < len(text); {
+		if text[i] != '\x1b' {
+			i++
+			continue
+		}
+		end, sgr, ok := escapeSequenceEnd(text, i)
+		if !ok {
+			i++
+			continue
+		}
+		if i > last {
+			result = append(result, highlightSpan{text[last:i], style.name()})
+		}
+		if sgr != "" && tr.showColors {
+			style.apply(sgr)
+		}
+		i = end
+		last = end
+	}
+	if last < len(text) {
+		result = append(result, highlightSpan{text[last:], style.name()})
+	}
+	return result
+}
+
+// escapeSequenceEnd returns position after the escape sequence starting at
+// position start of the text, and parameters of SGR sequences setting
+// colors, empty for other sequences. It is not ok, if there is no sequence
+func escapeSequenceEnd(text string, start int) (int, string, bool) {
+	i := start + 1
+	if i == len(text) {
+		return 0, "", false
+	}
+	switch c := text[i]; {
+	case c == '[':
+		// control sequence: parameters, intermediate bytes and a final byte
+		i++
+		paramsEnd := i
+		for paramsEnd < len(text) && text[paramsEnd] >= 0x30 && text[paramsEnd] <= 0x3f {
+			paramsEnd++
+		}
+		end := paramsEnd
+		for end < len(text) && text[end] >= 0x20 && text[end] <= 0x2f {
+			end++
+		}
+		if end == len(text) || text[end] < 0x40 || text[end] > 0x7e {
+			return 0, "", false
+		}
+		if text[end] == 'm' && end == paramsEnd {
+			params := text[i:paramsEnd]
+			if params == "" {
+				// empty parameters reset the style, like 0
+				params = "0"
+			}
+			return end + 1, params, true
+		}
+		return end + 1, "", true
+	case c == ']':
+		// operating system command, ended by BEL or ESC \
+		for end := i + 1; end < len(text); end++ {
+			if text[end] == '\a' {
+				return end + 1, "", true
+			}
+			if text[end] == '\x1b' && end+1 < len(text) && text[end+1] == '\\' {
+				return end + 2, "", true
+			}
+		}
+		return 0, "", false
+	case c >= 0x20 && c <= 0x2f:
+		// intermediate bytes and a final byte, e.g. selecting a character set
+		for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+			i++
+		}
+		if i < len(text) && text[i] >= 0x30 && text[i] <= 0x7e {
+			return i + 1, "", true
+		}
+		return 0, "", false
+	case c >= 0x40 && c <= 0x5f:
+		return i + 1, "", true
+	}
+	return 0, "", false
+}
+
+// ansiStyle is a style set by SGR escape sequences
+type ansiStyle struct {
+	fg, bg                   string // names of colors, empty for the default ones
+	bold, underline, reverse bool
+}
+
+// name returns name of the style in the theme, empty for the default style
+func (s ansiStyle) name() string {
+	if s == (ansiStyle{}) {
+		return ""
+	}
+	colorName := func(c string) string {
+		if c == "" {
+			return "default"
+		}
+		return c
+	}
+	result := "ansi." + colorName(s.fg) + "." + colorName(s.bg) + "."
+	for _, flag := range []struct {
+		on     bool
+		letter string
+	}{{s.bold, "b"}, {s.underline, "u"}, {s.reverse, "r"}} {
+		if flag.on {
+			result += flag.letter
+		}
+	}
+	return result
+}
+
+// apply changes the style by parameters of a SGR sequence. Colors out of the
+// basic ones are ignored
+func (s *ansiStyle) apply(params string) {
+	codes := strings.Split(params, ";")
+	for n := 0; n < len(codes); n++ {
+		code, _ := strconv.Atoi(codes[n])
+		switch {
+		case code == 0:
+			*s = ansiStyle{}
+		case code == 1:
+			s.bold = true
+		case code == 4:
+			s.underline = true
+		case code == 7:
+			s.reverse = true
+		case code == 22:
+			s.bold = false
+		case code == 24:
+			s.underline = false
+		case code == 27:
+			s.reverse = false
+		case code >= 30 && code <= 37:
+			s.fg = ansiColors[code-30]
+		case code >= 90 && code <= 97:
+			s.fg = ansiColors[code-90]
+		case code == 39:
+			s.fg = ""
+		case code >= 40 && code <= 47:
+			s.bg = ansiColors[code-40]
+		case code >= 100 && code <= 107:
+			s.bg = ansiColors[code-100]
+		case code == 49:
+			s.bg = ""
+		case (code == 38 || code == 48) && n+2 < len(codes) && codes[n+1] == "5":
+			// one of 256 colors, the first 16 are the basic ones
+			color := ""
+			if c, err := strconv.Atoi(codes[n+2]); err == nil && c < 16 {
+				color = ansiColors[c%8]
+			}
+			if code == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+			n += 2
+		case (code == 38 || code == 48) && n+1 < len(codes) && codes[n+1] == "2":
+			// true color is not shown
+			n += 4
+		}
+	}
+}
+
+// ansiThemeStyles returns styles of all combinations of ANSI colors and
+// decorations by their names
+func ansiThemeStyles() map[string]tui.Style {
+	result := make(map[string]tui.Style)
+	names := append([]string{""}, ansiColors...)
+	decoration := func(on bool) tui.Decoration {
+		if on {
+			return tui.DecorationOn
+		}
+		return tui.DecorationInherit
+	}
+	for _, fg := range names {
+		for _, bg := range names {
+			for flags := 0; flags != 8; flags++ {
+				s := ansiStyle{fg, bg, flags&1 != 0, flags&2 != 0, flags&4 != 0}
+				result[s.name()] = tui.Style{
+					Fg:        styleColors[s.fg],
+					Bg:        styleColors[s.bg],
+					Bold:      decoration(s.bold),
+					Underline: decoration(s.underline),
+					Reverse:   decoration(s.reverse),
+				}
+			}
+		}
+	}
+	delete(result, "")
+	return result
+}
+
+// visibleText returns spans of the text with tabs expanded to tab stops, and
+// control characters and bytes of invalid UTF-8 replaced by visible escapes
+// in style "control". The text starts at given column, it returns the column
+// following it
+func (tr *textRenderer) visibleText(text string, column int) ([]highlightSpan, int) {
+	var result []highlightSpan
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() != 0 {
+			result = append(result, highlightSpan{plain.String(), ""})
+			plain.Reset()
+		}
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		escape := ""
+		switch {
+		case r == '\t':
+			width := tr.tabWidth - column%tr.tabWidth
+			plain.WriteString(strings.Repeat(" ", width))
+			column += width
+		case r == utf8.RuneError && size == 1:
+			escape = fmt.Sprintf(`\x%02x`, text[i])
+		case r < 0x20:
+			escape = "^" + string(rune(r+0x40))
+		case r == 0x7f:
+			escape = "^?"
+		case r >= 0x80 && r < 0xa0:
+			escape = fmt.Sprintf(`\u%04x`, r)
+		default:
+			plain.WriteString(text[i : i+size])
+			column++
+		}
+		if escape != "" {
+			flush()
+			result = append(result, highlightSpan{escape, "control"})
+			column += len(escape)
+		}
+		i += size
+	}
+	flush()
+	return result, column
+}
+
+// spansWidth returns number of columns taken by the spans
+func spansWidth(spans []highlightSpan) int {
+	result := 0
+	for _, span := range spans {
+		result += utf8.RuneCountInString(span.text)
+	}
+	return result
+}
+
+// cutSpans returns part of the spans starting at column from, up to width
+// columns or all of them for negative width
+func cutSpans(spans []highlightSpan, from int, width int) []highlightSpan {
+	var result []highlightSpan
+	column := 0
+	for _, span := range spans {
+		runes := []rune(span.text)
+		start := from - column
+		if start < 0 {
+			start = 0
+		}
+		end := len(runes)
+		if width >= 0 && from+width-column < end {
+			end = from + width - column
+		}
+		if start < end {
+			result = append(result, highlightSpan{string(runes[start:end]), span.style})
+		}
+		column += len(runes)
+	}
+	if len(result) == 0 {
+		result = []highlightSpan{{"", ""}}
+	}
+	return result
+}
+
+// wrapSpans splits the spans into rows of given width, there is at least one
+func wrapSpans(spans []highlightSpan, width int) [][]highlightSpan {
+	total := spansWidth(spans)
+	result := [][]highlightSpan{cutSpans(spans, 0, width)}
+	for from := width; from < total; from += width {
+		result = append(result, cutSpans(spans, from, width))
+	}
+	return result
+}
+
+// matchColumn returns column of the first highlighted match of the searched
+// text in the spans
+func matchColumn(spans []highlightSpan) (int, bool) {
+	column := 0
+	for _, span := range spans {
+		if span.style == "search" {
+			return column, true
+		}
+		column += utf8.RuneCountInString(span.text)
+	}
+	return 0, false
+}
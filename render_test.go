@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRenderingText(t *testing.T) {
+	testCases := []struct {
+		showColors bool
+		text       string
+		expected   []highlightSpan
+	}{
+		{true, "", []highlightSpan{{"", ""}}},
+		{true, "plain", []highlightSpan{{"plain", ""}}},
+		{true, "a\tbc\td", []highlightSpan{{"a       bc      d", ""}}},
+		{true, "nul\x00 esc\x1b", []highlightSpan{{"nul", ""}, {"^@", "control"}, {" esc", ""}, {"^[", "control"}}},
+		{true, "del\x7f bad\xff \u0085", []highlightSpan{
+			{"del", ""}, {"^?", "control"}, {" bad", ""}, {`\xff`, "control"}, {" ", ""}, {`\u0085`, "control"}}},
+		{true, "^@\t\x01\tx", []highlightSpan{{"^@      ", ""}, {"^A", "control"}, {"      x", ""}}},
+		{true, "\x1b[31merror\x1b[0m done", []highlightSpan{{"error", "ansi.red.default."}, {" done", ""}}},
+		{true, "\x1b[1;44;97mhi\x1b[22mthere\x1b[m", []highlightSpan{{"hi", "ansi.white.blue.b"}, {"there", "ansi.white.blue."}}},
+		{true, "\x1b[38;5;9mx\x1b[38;2;1;2;3;4my", []highlightSpan{{"x", "ansi.red.default."}, {"y", "ansi.red.default.u"}}},
+		{false, "\x1b[31merror\x1b[0m 42", []highlightSpan{{"error", ""}, {" ", ""}, {"42", "token.number"}}},
+		{true, "\x1b[2K\x1b]0;title\ashown\x1b(B", []highlightSpan{{"shown", ""}}},
+		{true, "cut \x1b[31", []highlightSpan{{"cut ", ""}, {"^[", "control"}, {"[", ""}, {"31", "token.number"}}},
+	}
+
+	for n, c := range testCases {
+		tr := newTextRenderer(c.showColors, 8)
+		if observed := tr.spans(c.text, nil); !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+}
+
+func TestRenderingSearchedText(t *testing.T) {
+	tr := newTextRenderer(true, 4)
+	expected := []highlightSpan{
+		{"x ", "ansi.green.default."}, {"err", "search"}, {"or", "ansi.green.default."}, {" ", ""}, {"err", "search"}}
+	if observed := tr.spans("\x1b[32mx error\x1b[0m\terr", regexp.MustCompile("err")); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("want: %q, have: %q", expected, observed)
+	}
+}
+
+func TestANSIThemeStyles(t *testing.T) {
+	styles := ansiThemeStyles()
+	if len(styles) != 9*9*8-1 {
+		t.Errorf("number of styles want: %v, have: %v", 9*9*8-1, len(styles))
+	}
+	for _, name := range []string{"ansi.red.default.", "ansi.white.blue.b", "ansi.default.default.bur"} {
+		if _, ok := styles[name]; !ok {
+			t.Errorf("style %v is missing", name)
+		}
+	}
+}
+
+func TestCuttingSpans(t *testing.T) {
+	spans := []highlightSpan{{"ab", ""}, {"čde", "search"}, {"f", ""}}
+	testCases := []struct {
+		from     int
+		width    int
+		expected []highlightSpan
+	}{
+		{0, -1, spans},
+		{1, 3, []highlightSpan{{"b", ""}, {"čd", "search"}}},
+		{3, -1, []highlightSpan{{"de", "search"}, {"f", ""}}},
+		{5, 10, []highlightSpan{{"f", ""}}},
+		{6, 2, []highlightSpan{{"", ""}}},
+	}
+	for n, c := range testCases {
+		if observed := cutSpans(spans, c.from, c.width); !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+
+	expected := [][]highlightSpan{{{"ab", ""}, {"č", "search"}}, {{"de", "search"}, {"f", ""}}}
+	if observed := wrapSpans(spans, 3); !reflect.DeepEqual(observed, expected) {
+		t.Errorf("wrapSpans() want: %q, have: %q", expected, observed)
+	}
+	if observed := wrapSpans(nil, 3); len(observed) != 1 {
+		t.Errorf("wrapSpans() of empty text want: 1 row, have: %q", observed)
+	}
+	if column, ok := matchColumn(spans); column != 2 || !ok {
+		t.Errorf("matchColumn() want: 2, have: %v %v", column, ok)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// rotatable is implemented by files which can be replaced by a new file of the
+// same name, e.g. by logrotate
+type rotatable interface {
+	// reopenIfRotated returns the new file if the old one was replaced
+	reopenIfRotated() (io.ReadSeeker, bool)
+}
+
+// namedFile is a file which remembers its name, so it can be opened again
+type namedFile struct {
+	*os.File
+	name string
+	info os.FileInfo
+}
+
+func openNamedFile(name string) (*namedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	result := &namedFile{}
+	result.File = f
+	result.name = name
+	result.info = info
+	return result, nil
+}
+
+func (nf *namedFile) reopenIfRotated() (io.ReadSeeker, bool) {
+	info, err := os.Stat(nf.name)
+	if err != nil || os.SameFile(info, nf.info) {
+		// while being rotated the file can be missing for a moment
+		return nf, false
+	}
+	newFile, err := openNamedFile(nf.name)
+	if err != nil {
+		return nf, false
+	}
+	nf.File.Close()
+	return newFile, true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRotatedTextFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logviewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(name, []byte("old 1\nold 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	nf, err := openNamedFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf := NewTextFile(nf, 3)
+
+	if change := tf.update(); change != fileUnchanged {
+		t.Errorf("update() of unchanged file. want: %v, have: %v", fileUnchanged, change)
+	}
+
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if change := tf.update(); change != fileUnchanged {
+		t.Errorf("update() of missing file. want: %v, have: %v", fileUnchanged, change)
+	}
+
+	if err := ioutil.WriteFile(name, []byte("new 1\nnew 2\nnew 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if change := tf.update(); change != fileRotated {
+		t.Errorf("update() of rotated file. want: %v, have: %v", fileRotated, change)
+	}
+	expected := map[uint]FileLine{
+		0: FileLine{Contents: "new 1", position: 0},
+		1: FileLine{Contents: "new 2", position: 6},
+		2: FileLine{Contents: "new 3", position: 12}}
+	if !reflect.DeepEqual(tf.CachedLines, expected) {
+		t.Errorf("expect: %v, have: %v", expected, tf.CachedLines)
+	}
+	tf.rs.(*namedFile).Close()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// searchChunkSize is size of parts of the file searched concurrently
+var searchChunkSize int64 = 1024 * 1024
+
+// searchWorkers is number of chunks searched at once
+var searchWorkers = runtime.NumCPU()
+
+// searchChunk is a part of the file. It holds lines which start inside it
+type searchChunk struct {
+	start      int64
+	end        int64
+	matches    []matchingLine // indexes are relative to first line of the chunk
+	linesCount uint
+	linesEnd   int64 // position after the last complete line, 0 if none
+	err        error
+	done       chan struct{}
+}
+
+func newSearchChunk(start int64, end int64) *searchChunk {
+	result := &searchChunk{}
+	result.start = start
+	result.end = end
+	result.done = make(chan struct{})
+	return result
+}
+
+func (c *searchChunk) search(ctx context.Context, ra io.ReaderAt, enc *textEncoding, lineStart bool, filter func(FileLine) bool) {
+	defer close(c.done)
+
+	r := bufio.NewReader(io.NewSectionReader(ra, c.start, 1<<62))
+	pos := c.start
+	if !lineStart {
+		// the line started in the previous chunk, so it belongs to it
+		b, err := enc.readLine(r)
+		if err != nil {
+			if err != io.EOF {
+				c.err = err
+			}
+			return
+		}
+		pos += int64(len(b))
+		c.linesEnd = pos
+	}
+
+	for pos < c.end {
+		if c.linesCount%1024 == 0 && ctx.Err() != nil {
+			c.err = ctx.Err()
+			return
+		}
+		b, err := enc.readLine(r)
+		if err != nil {
+			if err != io.EOF {
+				c.err = err
+				return
+			}
+			// unfinished last line can match, but it is not counted as
+			// searched, so it is searched again when it is finished
+			if len(b) != 0 && filter(FileLine{Contents: enc.decode(b, pos), position: pos, incomplete: true}) {
+				c.matches = append(c.matches, matchingLine{index: c.linesCount, position: pos, incomplete: true})
+			}
+			return
+		}
+		if filter(FileLine{Contents: enc.decode(b, pos), position: pos}) {
+			c.matches = append(c.matches, matchingLine{index: c.linesCount, position: pos})
+		}
+		c.linesCount++
+		pos += int64(len(b))
+		c.linesEnd = pos
+	}
+}
+
+// isLineStart tells if a line starts at given position of the file, i.e. the
+// preceding bytes are a line ending of the encoding
+func isLineStart(ra io.ReaderAt, pos int64, enc *textEncoding) (bool, error) {
+	if pos == 0 {
+		return true, nil
+	}
+	start := Max(pos-2, 0)
+	b := make([]byte, pos-start)
+	if _, err := ra.ReadAt(b, start); err != nil {
+		return false, err
+	}
+	var prev byte
+	if len(b) == 2 {
+		prev = b[0]
+	}
+	return enc.isLineEnd(prev, b[len(b)-1], pos-1), nil
+}
+
+// searchFile finds lines passing the filter, starting at line fromLine placed
+// at position from, up to size. The file is split into chunks which are
+// searched concurrently. found is called with matching lines of each chunk, in
+// order of the file, and with number of bytes searched so far. It returns index
+// and position of the line following the last searched one
+func searchFile(
+	ctx context.Context,
+	ra io.ReaderAt,
+	enc *textEncoding,
+	from int64,
+	fromLine uint,
+	size int64,
+	filter func(FileLine) bool,
+	found func(matches []matchingLine, searched int64)) (uint, int64, error) {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// chunks start at a start of a character. Decompressed data are searched
+	// in one chunk, as their reads are not parallel and reading them back
+	// decompresses them again
+	chunkSize := enc.align(searchChunkSize)
+	if _, ok := ra.(*decompressedFile); ok {
+		chunkSize = Max(size-from, 1)
+	}
+	var chunks []*searchChunk
+	for start := from; start < size; start += chunkSize {
+		chunks = append(chunks, newSearchChunk(start, Min(start+chunkSize, size)))
+	}
+
+	jobs := make(chan *searchChunk)
+	go func() {
+		defer close(jobs)
+		for _, c := range chunks {
+			select {
+			case jobs <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i != searchWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				lineStart, err := isLineStart(ra, c.start, enc)
+				if err != nil {
+					c.err = err
+					close(c.done)
+					continue
+				}
+				c.search(ctx, ra, enc, lineStart || c.start == from, filter)
+			}
+		}()
+	}
+	defer wg.Wait()
+
+	nextLine := fromLine
+	end := from
+	for _, c := range chunks {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nextLine, end, ctx.Err()
+		}
+		if c.err != nil {
+			return nextLine, end, c.err
+		}
+		for i := range c.matches {
+			c.matches[i].index += nextLine
+		}
+		found(c.matches, c.end-from)
+		nextLine += c.linesCount
+		end = Max(end, c.linesEnd)
+	}
+	return nextLine, end, nil
+}
+
+// seekingReaderAt reads a file which can not be read concurrently
+type seekingReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (sr *seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if _, err := sr.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(sr.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchingFileInChunks(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+
+	fm := newFileMock("match\nother\n\nmatch again\nother\nmatch\nmat")
+	expected := []matchingLine{{0, 0, false, false}, {3, 13, false, false}, {5, 31, false, false}, {6, 37, false, true}}
+	filter := func(line FileLine) bool { return strings.HasPrefix(line.Contents, "mat") }
+
+	for _, chunkSize := range []int64{1, 2, 5, 6, 7, 13, 100} {
+		searchChunkSize = chunkSize
+		var matches []matchingLine
+		var lastSearched int64
+		nextLine, end, err := searchFile(context.Background(), fm, utf8Encoding, 0, 0, int64(len(fm.contents)), filter,
+			func(m []matchingLine, searched int64) {
+				matches = append(matches, m...)
+				if searched < lastSearched {
+					t.Errorf("Chunk size %v: progress went back from %v to %v", chunkSize, lastSearched, searched)
+				}
+				lastSearched = searched
+			})
+		if err != nil {
+			t.Errorf("Chunk size %v: searchFile() failed: %v", chunkSize, err)
+		}
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("Chunk size %v: want: %v, have: %v", chunkSize, expected, matches)
+		}
+		if nextLine != 6 || end != 37 {
+			t.Errorf("Chunk size %v: next line want: 6 37, have: %v %v", chunkSize, nextLine, end)
+		}
+		if lastSearched != int64(len(fm.contents)) {
+			t.Errorf("Chunk size %v: progress want: %v, have: %v", chunkSize, len(fm.contents), lastSearched)
+		}
+	}
+}
+
+func TestSearchingRestOfFile(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+	searchChunkSize = 4
+
+	fm := newFileMock("a\nb\na\nb\na\n")
+	var matches []matchingLine
+	nextLine, end, err := searchFile(context.Background(), fm, utf8Encoding, 4, 2, int64(len(fm.contents)), substringFilter("a"),
+		func(m []matchingLine, searched int64) { matches = append(matches, m...) })
+	if err != nil {
+		t.Errorf("searchFile() failed: %v", err)
+	}
+	if expected := []matchingLine{{2, 4, false, false}, {4, 8, false, false}}; !reflect.DeepEqual(matches, expected) {
+		t.Errorf("want: %v, have: %v", expected, matches)
+	}
+	if nextLine != 5 || end != 10 {
+		t.Errorf("next line want: 5 10, have: %v %v", nextLine, end)
+	}
+}
+
+func TestCancellingSearch(t *testing.T) {
+	fm := newFileMock("a\nb\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := searchFile(ctx, fm, utf8Encoding, 0, 0, int64(len(fm.contents)), substringFilter("a"),
+		func(m []matchingLine, searched int64) {})
+	if err != context.Canceled {
+		t.Errorf("searchFile() error want: %v, have: %v", context.Canceled, err)
+	}
+}
+
+func TestSearchingNotConcurrentFile(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+	searchChunkSize = 3
+
+	ra := &seekingReaderAt{rs: newFileMock("a\nb\na\n")}
+	var matches []matchingLine
+	if _, _, err := searchFile(context.Background(), ra, utf8Encoding, 0, 0, 6, substringFilter("a"),
+		func(m []matchingLine, searched int64) { matches = append(matches, m...) }); err != nil {
+		t.Errorf("searchFile() failed: %v", err)
+	}
+	if expected := []matchingLine{{0, 0, false, false}, {2, 4, false, false}}; !reflect.DeepEqual(matches, expected) {
+		t.Errorf("want: %v, have: %v", expected, matches)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatDetectionLines is number of lines used to detect format of the log
+const formatDetectionLines = 16
+
+// defaultColumns are fields shown as columns of structured logs
+var defaultColumns = []string{"time", "level", "logger", "msg"}
+
+// logFormat parses lines of a structured log into fields
+type logFormat struct {
+	name       string
+	parse      func(contents string) (logFields, bool)
+	detect     func(contents string) bool // tells if the line is in the format, nil if parse does
+	timeLayout string                     // layout of the time field, known formats are tried if empty
+}
+
+// builtinLogFormats are formats known without configuration
+var builtinLogFormats = []*logFormat{
+	{name: "json", parse: parseJSONLine},
+	{name: "logfmt", parse: parseLogfmtLine},
+	{name: "syslog", parse: parseSyslogLine},
+}
+
+// logFormats are formats which can be detected, user defined ones first
+var logFormats = builtinLogFormats
+
+// logFields are fields of a structured log line. Values of nested objects are
+// maps and values of arrays are slices
+type logFields map[string]interface{}
+
+// fieldAliases are names used for common fields by various loggers
+var fieldAliases = map[string][]string{
+	"time":    {"ts", "timestamp", "@timestamp", "t", "date"},
+	"level":   {"lvl", "severity", "loglevel", "log.level", "@level"},
+	"logger":  {"logger_name", "name", "component", "module", "app"},
+	"msg":     {"message", "@message", "text"},
+	"message": {"msg", "@message", "text"},
+}
+
+// numericLevels are numeric levels of bunyan and pino
+var numericLevels = map[string]logLevel{
+	"10": levelTrace,
+	"20": levelDebug,
+	"30": levelInfo,
+	"40": levelWarn,
+	"50": levelError,
+	"60": levelFatal,
+}
+
+// get returns value of the field of given name or path of nested fields
+// separated by dots, like ctx.user.id. Elements of arrays are addressed by
+// their index
+func (lf logFields) get(path string) (interface{}, bool) {
+	if v, ok := lf[path]; ok {
+		return v, true
+	}
+	var v interface{} = map[string]interface{}(lf)
+	for _, key := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			next, ok := c[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// field returns value of the field as text. Common fields are looked up also
+// under names of their aliases
+func (lf logFields) field(name string) (string, bool) {
+	v, ok := lf.get(name)
+	for _, alias := range fieldAliases[name] {
+		if ok {
+			break
+		}
+		v, ok = lf.get(alias)
+	}
+	if !ok {
+		return "", false
+	}
+	text := formatFieldValue(v)
+	if l, ok := numericLevels[text]; ok && name == "level" {
+		return l.String(), true
+	}
+	return text, true
+}
+
+func formatFieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// field returns field of the line. Lines not in the format, like stack
+// traces, have fields of plain text lines
+func (f *logFormat) field(line FileLine, name string) (string, bool) {
+	if name == "line" {
+		return line.Contents, true
+	}
+	fields, ok := f.parse(line.Contents)
+	if !ok {
+		return plainTextField(line, name)
+	}
+	return fields.field(name)
+}
+
+// timeOf returns time of the line given by its time field
+func (f *logFormat) timeOf(contents string) (time.Time, bool) {
+	fields, ok := f.parse(contents)
+	if !ok {
+		return time.Time{}, false
+	}
+	text, ok := fields.field("time")
+	if !ok {
+		return time.Time{}, false
+	}
+	if f.timeLayout != "" {
+		t, err := time.Parse(f.timeLayout, text)
+		return t, err == nil
+	}
+	return parseTimestamp(text)
+}
+
+// matches tells if the line is in the format
+func (f *logFormat) matches(contents string) bool {
+	if f.detect != nil {
+		return f.detect(contents)
+	}
+	_, ok := f.parse(contents)
+	return ok
+}
+
+// parseJSONLine parses a line with a JSON object
+func parseJSONLine(contents string) (logFields, bool) {
+	contents = strings.TrimSpace(contents)
+	if !strings.HasPrefix(contents, "{") {
+		return nil, false
+	}
+	d := json.NewDecoder(strings.NewReader(contents))
+	d.UseNumber()
+	var fields logFields
+	if err := d.Decode(&fields); err != nil {
+		return nil, false
+	}
+	return fields, true
+}
+
+// parseLogfmtLine parses a line of key=value pairs separated by spaces, like
+// level=info msg="request done" dur=12ms. Values with spaces are quoted, with
+// escapes of Go strings. The line must have at least two pairs, so plain text
+// mentioning a key=value is not taken for logfmt
+func parseLogfmtLine(contents string) (logFields, bool) {
+	fields := logFields{}
+	i := 0
+	for {
+		for i < len(contents) && contents[i] == ' ' {
+			i++
+		}
+		if i == len(contents) {
+			break
+		}
+		start := i
+		for i < len(contents) && contents[i] != '=' && contents[i] != ' ' && contents[i] != '"' {
+			i++
+		}
+		if i == start || i == len(contents) || contents[i] != '=' {
+			return nil, false
+		}
+		key := contents[start:i]
+		i++
+		value := ""
+		if i < len(contents) && contents[i] == '"' {
+			end := i + 1
+			for end < len(contents) && contents[end] != '"' {
+				if contents[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(contents) {
+				return nil, false
+			}
+			unquoted, err := strconv.Unquote(contents[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			value = unquoted
+			i = end + 1
+			if i < len(contents) && contents[i] != ' ' {
+				return nil, false
+			}
+		} else {
+			start = i
+			for i < len(contents) && contents[i] != ' ' {
+				i++
+			}
+			value = contents[start:i]
+		}
+		fields[key] = value
+	}
+	return fields, len(fields) >= 2
+}
+
+// findLogFormat returns format of given name, nil for plain text
+func findLogFormat(name string) (*logFormat, bool) {
+	if name == "plain" {
+		return nil, true
+	}
+	for _, f := range logFormats {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// detectLogFormat returns format of most of the lines, nil if they are plain
+// text. Empty lines are not taken into account
+func detectLogFormat(lines []string) *logFormat {
+	var result *logFormat
+	best := 0
+	for _, f := range logFormats {
+		count, total := 0, 0
+		for _, line := range lines {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			total++
+			if f.matches(line) {
+				count++
+			}
+		}
+		if count*2 > total && count > best {
+			result = f
+			best = count
+		}
+	}
+	return result
+}
+
+// columnValues returns values of the fields shown as columns. Lines not in the
+// format are shown whole in the last column
+func (f *logFormat) columnValues(line FileLine, columns []string) []string {
+	result := make([]string, len(columns))
+	fields, ok := f.parse(line.Contents)
+	if !ok {
+		result[len(result)-1] = line.Contents
+		return result
+	}
+	for n, name := range columns {
+		result[n], _ = fields.field(name)
+	}
+	return result
+}
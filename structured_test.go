@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJSONFields(t *testing.T) {
+	format, _ := findLogFormat("json")
+	line := FileLine{Contents: `{"ts":"2019-11-25T10:00:01Z","level":30,"msg":"login","ctx":{"user":{"id":42,"admin":false},"roles":["a","b"]},"req.id":"r1","err":null}`}
+	testCases := []struct {
+		name     string
+		expected string
+		found    bool
+	}{
+		{"time", "2019-11-25T10:00:01Z", true},
+		{"level", "INFO", true},
+		{"message", "login", true},
+		{"ctx.user.id", "42", true},
+		{"ctx.user.admin", "false", true},
+		{"ctx.roles.1", "b", true},
+		{"ctx.roles", `["a","b"]`, true},
+		{"ctx.user", `{"admin":false,"id":42}`, true},
+		{"req.id", "r1", true},
+		{"err", "null", true},
+		{"ctx.user.name", "", false},
+		{"ctx.roles.2", "", false},
+		{"logger", "", false},
+	}
+
+	for n, c := range testCases {
+		observed, found := format.field(line, c.name)
+		if observed != c.expected || found != c.found {
+			t.Errorf("Case %v: field %q want: %q %v, have: %q %v", n, c.name, c.expected, c.found, observed, found)
+		}
+	}
+
+	// lines which are not JSON have fields of plain text
+	if observed, _ := format.field(FileLine{Contents: "panic: ERROR here"}, "level"); observed != "ERROR" {
+		t.Errorf("level of plain text line want: ERROR, have: %q", observed)
+	}
+}
+
+func TestFilteringJSONLines(t *testing.T) {
+	format, _ := findLogFormat("json")
+	lines := []string{
+		`{"level":"info","msg":"login","ctx":{"user":{"id":42}}}`,
+		`{"level":"error","msg":"denied","ctx":{"user":{"id":7}}}`,
+		`goroutine 1 [running]:`,
+		`{"level":"warn","msg":"slow","dur":120}`,
+	}
+	testCases := []struct {
+		expression string
+		expected   []int
+	}{
+		{"ctx.user.id=42", []int{0}},
+		{"ctx.user.id>10", []int{0}},
+		{"level>=WARN", []int{1, 3}},
+		{"msg~/^(login|slow)$/", []int{0, 3}},
+		{"not ctx.user.id=42", []int{1, 2, 3}},
+		{"goroutine", []int{2}},
+	}
+
+	for n, c := range testCases {
+		filter, err := newFilter(c.expression, format.field)
+		if err != nil {
+			t.Errorf("Case %v: newFilter() failed: %v", n, err)
+			continue
+		}
+		var observed []int
+		for i, contents := range lines {
+			if filter(FileLine{Contents: contents}) {
+				observed = append(observed, i)
+			}
+		}
+		if !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: %q want: %v, have: %v", n, c.expression, c.expected, observed)
+		}
+	}
+}
+
+func TestDetectingLogFormat(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		expected string // name of the format, empty for plain text
+	}{
+		{[]string{`{"msg":"a"}`, "", `  {"msg":"b"}`, "not json"}, "json"},
+		{[]string{`{"msg":"a"}`, "not json", "plain"}, ""},
+		{[]string{"2019-11-25 INFO started"}, ""},
+		{[]string{`level=info msg="started" dur=12ms`, `level=warn msg="slow \"db\""`, "  at stack"}, "logfmt"},
+		{[]string{"connecting to host=db1", "INFO a=1 b=2"}, ""},
+		{nil, ""},
+	}
+
+	for n, c := range testCases {
+		observed := ""
+		if format := detectLogFormat(c.lines); format != nil {
+			observed = format.name
+		}
+		if observed != c.expected {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+}
+
+func TestColumnValues(t *testing.T) {
+	format, _ := findLogFormat("json")
+	testCases := []struct {
+		contents string
+		expected []string
+	}{
+		{`{"time":"10:00","severity":"WARN","logger":"db","message":"slow"}`, []string{"10:00", "WARN", "db", "slow"}},
+		{`{"msg":"only message"}`, []string{"", "", "", "only message"}},
+		{"\tat com.example.Main", []string{"", "", "", "\tat com.example.Main"}},
+	}
+
+	for n, c := range testCases {
+		if observed := format.columnValues(FileLine{Contents: c.contents}, defaultColumns); !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+}
+
+func TestParsingLogfmt(t *testing.T) {
+	testCases := []struct {
+		contents string
+		expected logFields // nil if the line is not logfmt
+	}{
+		{`level=info msg="request done" dur=12ms`, logFields{"level": "info", "msg": "request done", "dur": "12ms"}},
+		{`  msg="say \"hi\"\tthere" path=C:\\dir empty= `, logFields{"msg": "say \"hi\"\tthere", "path": `C:\\dir`, "empty": ""}},
+		{`a=1 b="caf\u00e9"`, logFields{"a": "1", "b": "café"}},
+		{`only=one`, nil},
+		{`a=1 bare b=2`, nil},
+		{`a=1 b="unterminated`, nil},
+		{`a=1 b="x"y`, nil},
+		{`a=1 ="no key"`, nil},
+		{``, nil},
+	}
+
+	for n, c := range testCases {
+		observed, ok := parseLogfmtLine(c.contents)
+		if c.expected == nil {
+			if ok {
+				t.Errorf("Case %v: %q want: not logfmt, have: %v", n, c.contents, observed)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: %q want: %v, have: %v %v", n, c.contents, c.expected, observed, ok)
+		}
+	}
+}
+
+func TestFilteringLogfmtLines(t *testing.T) {
+	format, _ := findLogFormat("logfmt")
+	filter, _ := newFilter(`level>=warn msg:"slow query"`, format.field)
+	testCases := []struct {
+		contents string
+		expected bool
+	}{
+		{`level=warn msg="Slow query took 2s" db=main`, true},
+		{`level=info msg="slow query took 2s"`, false},
+		{`level=error msg=slow`, false},
+		{`WARN slow query`, true},
+	}
+
+	for n, c := range testCases {
+		if observed := filter(FileLine{Contents: c.contents}); observed != c.expected {
+			t.Errorf("Case %v: %q want: %v, have: %v", n, c.contents, c.expected, observed)
+		}
+	}
+	if observed := format.columnValues(FileLine{Contents: `ts=10:00 lvl=warn msg="slow"`}, defaultColumns); !reflect.DeepEqual(observed, []string{"10:00", "warn", "", "slow"}) {
+		t.Errorf("columns want: %q, have: %q", []string{"10:00", "warn", "", "slow"}, observed)
+	}
+}
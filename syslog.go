@@ -0,0 +1,147 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// syslogFacilities are names of facilities by their codes
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogSeverities are names of severities by their codes with their levels
+var syslogSeverities = []struct {
+	name  string
+	level logLevel
+}{
+	{"emerg", levelFatal},
+	{"alert", levelFatal},
+	{"crit", levelFatal},
+	{"err", levelError},
+	{"warning", levelWarn},
+	{"notice", levelInfo},
+	{"info", levelInfo},
+	{"debug", levelDebug},
+}
+
+// rfc3164Pattern matches BSD syslog line, also without the priority as in
+// files written by syslog daemons: <PRI>Mmm dd hh:mm:ss host tag[pid]: msg
+var rfc3164Pattern = regexp.MustCompile(
+	`^(?:<(\d{1,3})>)?([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (\S+) (?:([^:\[\s]+)(?:\[([^\]]*)\])?: ?)?(.*)$`)
+
+// rfc5424Pattern matches header of RFC 5424 syslog line, structured data and
+// message follow it: <PRI>1 time host app procid msgid
+var rfc5424Pattern = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) (\S+) (\S+) (\S+) `)
+
+// parseSyslogLine parses RFC 5424 or RFC 3164 syslog line. Severity of the
+// line is its level. Missing values, "-" in RFC 5424, are left out
+func parseSyslogLine(contents string) (logFields, bool) {
+	if m := rfc5424Pattern.FindStringSubmatch(contents); m != nil {
+		fields := logFields{}
+		if !setSyslogPriority(fields, m[1]) {
+			return nil, false
+		}
+		for n, name := range []string{"time", "host", "app", "procid", "msgid"} {
+			if m[n+2] != "-" {
+				fields[name] = m[n+2]
+			}
+		}
+		sd, rest, ok := parseStructuredData(contents[len(m[0]):])
+		if !ok {
+			return nil, false
+		}
+		if sd != nil {
+			fields["sd"] = sd
+		}
+		// message may start with UTF-8 byte order mark
+		fields["msg"] = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+		return fields, true
+	}
+	if m := rfc3164Pattern.FindStringSubmatch(contents); m != nil {
+		fields := logFields{}
+		if m[1] != "" && !setSyslogPriority(fields, m[1]) {
+			return nil, false
+		}
+		fields["time"] = m[2]
+		fields["host"] = m[3]
+		if m[4] != "" {
+			fields["app"] = m[4]
+		}
+		if m[5] != "" {
+			fields["procid"] = m[5]
+		}
+		fields["msg"] = m[6]
+		if _, ok := fields["level"]; !ok {
+			if l := detectLevel(m[6]); l != levelUnknown {
+				fields["level"] = l.String()
+			}
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// setSyslogPriority sets facility, severity and level of the priority
+func setSyslogPriority(fields logFields, pri string) bool {
+	n, err := strconv.Atoi(pri)
+	if err != nil || n/8 >= len(syslogFacilities) {
+		return false
+	}
+	severity := syslogSeverities[n%8]
+	fields["facility"] = syslogFacilities[n/8]
+	fields["severity"] = severity.name
+	fields["level"] = severity.level.String()
+	return true
+}
+
+// parseStructuredData parses structured data of RFC 5424 line into map of
+// parameters by their SD-ID, nil for "-". It returns also the rest of the
+// line
+func parseStructuredData(text string) (map[string]interface{}, string, bool) {
+	if strings.HasPrefix(text, "-") {
+		return nil, text[1:], true
+	}
+	result := make(map[string]interface{})
+	for strings.HasPrefix(text, "[") {
+		end := strings.IndexAny(text, " ]")
+		if end < 0 {
+			return nil, "", false
+		}
+		params := make(map[string]interface{})
+		result[text[1:end]] = params
+		text = text[end:]
+		for strings.HasPrefix(text, " ") {
+			eq := strings.Index(text, `="`)
+			if eq < 0 {
+				return nil, "", false
+			}
+			name := text[1:eq]
+			var sb strings.Builder
+			i := eq + 2
+			for ; i < len(text) && text[i] != '"'; i++ {
+				// only ", \ and ] are escaped
+				if text[i] == '\\' && i+1 < len(text) && strings.IndexByte(`"\]`, text[i+1]) >= 0 {
+					i++
+				}
+				sb.WriteByte(text[i])
+			}
+			if i == len(text) {
+				return nil, "", false
+			}
+			params[name] = sb.String()
+			text = text[i+1:]
+		}
+		if !strings.HasPrefix(text, "]") {
+			return nil, "", false
+		}
+		text = text[1:]
+	}
+	if len(result) == 0 {
+		return nil, "", false
+	}
+	return result, text, true
+}
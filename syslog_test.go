@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsingSyslog(t *testing.T) {
+	testCases := []struct {
+		contents string
+		expected logFields // nil if the line is not syslog
+	}{
+		{
+			`<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - BOM'su root' failed`,
+			logFields{"facility": "auth", "severity": "crit", "level": "FATAL", "time": "2003-10-11T22:14:15.003Z",
+				"host": "mymachine.example.com", "app": "su", "msgid": "ID47", "msg": "BOM'su root' failed"}},
+		{
+			`<165>1 2003-10-11T22:14:15.003Z host evntslog 42 - [exampleSDID@32473 iut="3" eventSource="App\"q\]"][meta seq="1"] started`,
+			logFields{"facility": "local4", "severity": "notice", "level": "INFO", "time": "2003-10-11T22:14:15.003Z",
+				"host": "host", "app": "evntslog", "procid": "42", "msg": "started",
+				"sd": map[string]interface{}{
+					"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventSource": `App"q]`},
+					"meta":              map[string]interface{}{"seq": "1"}}}},
+		{
+			"<13>1 - - - - - -",
+			logFields{"facility": "user", "severity": "notice", "level": "INFO", "msg": ""}},
+		{
+			"<11>Nov 25 10:00:01 web01 nginx[812]: upstream timed out",
+			logFields{"facility": "user", "severity": "err", "level": "ERROR", "time": "Nov 25 10:00:01",
+				"host": "web01", "app": "nginx", "procid": "812", "msg": "upstream timed out"}},
+		{
+			"Nov  5 10:00:01 web01 kernel: WARNING: CPU throttled",
+			logFields{"time": "Nov  5 10:00:01", "host": "web01", "app": "kernel", "level": "WARN", "msg": "WARNING: CPU throttled"}},
+		{
+			"Nov 25 10:00:01 web01 -- MARK --",
+			logFields{"time": "Nov 25 10:00:01", "host": "web01", "msg": "-- MARK --"}},
+		{"<999>1 2003-10-11T22:14:15Z h a - - - x", nil},
+		{"<34>1 2003-10-11T22:14:15Z h a - - [unterminated x", nil},
+		{"2019-11-25 10:00:01 INFO started", nil},
+	}
+
+	for n, c := range testCases {
+		observed, ok := parseSyslogLine(c.contents)
+		if c.expected == nil {
+			if ok {
+				t.Errorf("Case %v: want: not syslog, have: %v", n, observed)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %v\nhave: %v %v", n, c.expected, observed, ok)
+		}
+	}
+}
+
+func TestSyslogFields(t *testing.T) {
+	format, _ := findLogFormat("syslog")
+	lines := []string{
+		`<165>1 2019-11-25T10:00:01Z host app 42 - [meta seq="7"] started`,
+		"<11>Nov 25 10:00:02 host app[1]: failed",
+		"<15>Nov 25 10:00:03 host app[1]: debugging",
+	}
+	filter, _ := newFilter(`level>=WARN or sd.meta.seq=7 or severity=debug`, format.field)
+	for n, contents := range lines {
+		if !filter(FileLine{Contents: contents}) {
+			t.Errorf("Case %v: %q does not pass the filter", n, contents)
+		}
+	}
+	if f := detectLogFormat(lines); f != format {
+		t.Errorf("detectLogFormat() want: syslog, have: %v", f)
+	}
+
+	expected := time.Date(2019, 11, 25, 10, 0, 1, 0, time.UTC)
+	if observed, ok := format.timeOf(lines[0]); !ok || !observed.Equal(expected) {
+		t.Errorf("timeOf() want: %v, have: %v %v", expected, observed, ok)
+	}
+}
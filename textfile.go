@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,16 +11,84 @@ import (
 
 // FileLine holds line of text from the file and its position inside the file
 type FileLine struct {
-	Contents string
-	position int64
+	Contents  string
+	position  int64
+	isContext bool // line is shown only as context of a matching line
+	source    int  // index of the file of the line in the merged view
+	// the last line of the file without a line ending, which may be still
+	// being written
+	incomplete bool
+	raw        string // contents with invalid bytes of UTF-8, empty if they are valid
+}
+
+// rawContents returns contents of the line with invalid bytes of UTF-8 kept
+func (line FileLine) rawContents() string {
+	if line.raw != "" {
+		return line.raw
+	}
+	return line.Contents
 }
 
 // TextFile keeps line of file in user-defined size cache
 type TextFile struct {
-	CachedLines       map[uint]FileLine
-	cacheSize         uint // number of lines to be cached
-	rs                io.ReadSeeker
-	startingLineIndex uint
+	CachedLines        map[uint]FileLine
+	cacheSize          uint // number of lines to be cached
+	rs                 io.ReadSeeker
+	startingLineIndex  uint
+	size               int64            // size of the file when it was last checked
+	sizeKnown          bool             // size of a decompressed file is known once it was read whole
+	index              *lineIndex       // nil if the file is not indexed
+	timeFormat         *timestampFormat // nil if no lines with a timestamp were found
+	timeFormatDetected bool
+	logFormat          *logFormat // format of structured log, nil for plain text
+	err                error      // error of the last reading of the file, nil if it succeeded
+	enc                *textEncoding
+	encodingGiven      bool // encoding was given by the user, it is not detected
+}
+
+// errLineOutOfRange is returned for lines after the end of the file
+var errLineOutOfRange = errors.New("line is out of range")
+
+// errFileRotated is returned when the file got smaller, because it was
+// truncated or replaced, so known positions of lines are not valid
+var errFileRotated = errors.New("file was truncated or rotated")
+
+// errIO is wrapped by errors of reading the file
+var errIO = errors.New("I/O error")
+
+// ioError is a failed operation of reading the file
+type ioError struct {
+	op  string
+	err error
+}
+
+func (e *ioError) Error() string {
+	return fmt.Sprintf("%v: %v failed: %v", errIO, e.op, e.err)
+}
+
+func (e *ioError) Unwrap() error {
+	return e.err
+}
+
+func (e *ioError) Is(target error) bool {
+	return target == errIO
+}
+
+// sizedLater is implemented by files, whose size is known only once they are
+// read up to the end, like decompressed files
+type sizedLater interface {
+	// knownSize returns size of the file, if its end was already read
+	knownSize() (int64, bool)
+	// readSize reads the file up to the end and returns its size
+	readSize() (int64, error)
+}
+
+// failing is implemented by line sources, which keep error of reading their
+// files
+type failing interface {
+	// lastError returns error of the last reading of the file, nil if it
+	// succeeded
+	lastError() error
 }
 
 // NewTextFile creates new text file for given filepath
@@ -29,59 +98,136 @@ func NewTextFile(rs io.ReadSeeker, cacheSize uint) *TextFile {
 	result.startingLineIndex = 0
 	result.CachedLines = make(map[uint]FileLine)
 	result.cacheSize = cacheSize
-	result.rs.Seek(0, io.SeekStart)
-	result.goTo(result.startingLineIndex)
+	size, known, err := result.fileSize()
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.size = size
+	result.sizeKnown = known
+	result.detectEncoding()
+	result.setError(result.goTo(result.startingLineIndex))
 	return result
 }
 
-func getLinePosition(rs io.ReadSeeker, fromLine uint, fromPos int64, lineOffset int) (int64, error) {
-	if fromPos == 0 {
-		return 0, nil
+// detectEncoding detects encoding of the file from its start, unless it was
+// given by the user
+func (tf *TextFile) detectEncoding() {
+	if tf.encodingGiven {
+		return
 	}
-	bufferSize := Min(1024*512, fromPos-1)
-	rs.Seek(fromPos-1, io.SeekStart)
-	rs.Seek(-bufferSize, io.SeekCurrent)
-	r := bufio.NewReader(rs)
+	size := int64(encodingDetectionSize)
+	if tf.sizeKnown {
+		size = Min(size, tf.size)
+	}
+	head := make([]byte, size)
+	n, _ := tf.readerAt().ReadAt(head, 0)
+	tf.enc = detectEncoding(head[:n])
+}
 
-	b := make([]byte, bufferSize)
-	if _, err := r.Read(b); err != nil {
-		fmt.Println("Read() failed: ", err.Error())
+// fileSize returns current size of the file. Size of a decompressed file is
+// not known, until its end is read, e.g. by the indexer or a search, so
+// opening it does not decompress it whole
+func (tf *TextFile) fileSize() (int64, bool, error) {
+	if sl, ok := tf.rs.(sizedLater); ok {
+		size, known := sl.knownSize()
+		return size, known, nil
 	}
+	size, err := tf.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, false, &ioError{"seek", err}
+	}
+	return size, true, nil
+}
 
-	var i int64
-	currentLine := fromLine
-	newLineOffset := lineOffset
-	var posInFile int64
-	for i = bufferSize - 1; i != -1; i-- {
-		posInFile = fromPos - (bufferSize - i)
-		if b[i] == '\n' {
+// setEncoding reads the file again in given encoding
+func (tf *TextFile) setEncoding(enc *textEncoding) {
+	tf.enc = enc
+	tf.encodingGiven = true
+	tf.CachedLines = make(map[uint]FileLine)
+	tf.startingLineIndex = 0
+	tf.timeFormatDetected = false
+	if tf.index != nil {
+		tf.startIndexing()
+	}
+	tf.setError(tf.goTo(0))
+}
+
+// getLinePosition returns position of the line lineOffset lines before line
+// fromLine, which starts at fromPos. Line endings of the encoding preceding it
+// are counted
+func getLinePosition(rs io.ReadSeeker, enc *textEncoding, fromLine uint, fromPos int64, lineOffset int) (int64, error) {
+	target := int(fromLine) + lineOffset
+	if lineOffset > 0 || target < 0 {
+		return 0, errLineOutOfRange
+	}
+	if lineOffset == 0 {
+		return fromPos, nil
+	}
+	currentLine := int(fromLine)
+	end := fromPos
+	b := make([]byte, 1+1024*512)
+	for end > 0 {
+		start := end - Min(int64(len(b)-1), end)
+		// the byte preceding the buffer can be a part of a line ending
+		readStart := Max(start-1, 0)
+		buffer := b[:end-readStart]
+		if _, err := rs.Seek(readStart, io.SeekStart); err != nil {
+			return 0, &ioError{"seek", err}
+		}
+		if _, err := io.ReadFull(rs, buffer); err != nil {
+			return 0, &ioError{"read", err}
+		}
+		var prev byte
+		if readStart < start {
+			prev = buffer[0]
+			buffer = buffer[1:]
+		}
+		var ends []int64
+		enc.lineEnds(buffer, start, prev, func(lineEnd int64) {
+			// line ending of the preceding line is not counted
+			if lineEnd < fromPos {
+				ends = append(ends, lineEnd)
+			}
+		})
+		for i := len(ends) - 1; i >= 0; i-- {
 			currentLine--
-			newLineOffset++
-			//			fmt.Println("Line at:", currentLine, newLineOffset, posInFile)
-			if int(currentLine) == int(fromLine)+lineOffset {
-				return posInFile, nil
+			if currentLine == target {
+				return ends[i], nil
 			}
 		}
+		end = start
 	}
-
-	if posInFile == 0 {
-		return 0, fmt.Errorf("Error")
+	// the first line of the file is not preceded by a line ending
+	if currentLine-1 == target {
+		return 0, nil
 	}
-
-	return getLinePosition(rs, currentLine, posInFile, newLineOffset)
+	return 0, errLineOutOfRange
 }
 
-func (tf *TextFile) goTo(lineIndex uint) {
+// goTo reads up to cacheSize lines starting at lineIndex into the cache. It
+// returns errLineOutOfRange if the file has no such line, errFileRotated if
+// the file got smaller since it was checked by update and an error wrapping
+// errIO if reading fails
+func (tf *TextFile) goTo(lineIndex uint) error {
 	var curLine uint
 	var p int64
-	r := bufio.NewReader(tf.rs)
+	cpLine, cpPos := tf.checkpoint(lineIndex)
 	if lineIndex < tf.startingLineIndex {
-		if _, ok := tf.CachedLines[tf.startingLineIndex]; ok {
-			p, _ = getLinePosition(
+		if lineIndex-cpLine < lineIndexInterval {
+			curLine = cpLine
+			p = cpPos
+		} else if _, ok := tf.CachedLines[tf.startingLineIndex]; ok {
+			var err error
+			p, err = getLinePosition(
 				tf.rs,
+				tf.enc,
 				tf.startingLineIndex,
 				tf.CachedLines[tf.startingLineIndex].position,
 				int(lineIndex)-int(tf.startingLineIndex))
+			if err != nil {
+				return err
+			}
 			curLine = lineIndex
 		}
 	} else {
@@ -95,23 +241,38 @@ func (tf *TextFile) goTo(lineIndex uint) {
 				curLine = tf.startingLineIndex + tf.cacheSize - 1
 				p = line.position
 			}
+			if cpLine > curLine {
+				curLine = cpLine
+				p = cpPos
+			}
 		}
 	}
 
+	if err := tf.checkRotated(); err != nil {
+		return err
+	}
+	if _, err := tf.rs.Seek(p, io.SeekStart); err != nil {
+		return &ioError{"seek", err}
+	}
+
 	tf.CachedLines = make(map[uint]FileLine)
 	tf.startingLineIndex = lineIndex
 
-	tf.rs.Seek(p, io.SeekStart)
+	r := bufio.NewReader(tf.rs)
 	for {
-		b, err := r.ReadBytes('\n')
-		if err != nil {
+		b, err := tf.enc.readLine(r)
+		if err != nil && err != io.EOF {
+			return &ioError{"read", err}
+		}
+		if err != nil && len(b) == 0 {
 			break
 		}
 
 		if curLine >= lineIndex {
-			notRNEndLine := strings.TrimSuffix(string(b), "\r\n") // deal with "\r\n"
-			notREndLine := strings.TrimSuffix(notRNEndLine, "\n") // deal with "\n"
-			tf.CachedLines[curLine] = FileLine{notREndLine, p}
+			tf.CachedLines[curLine] = tf.enc.decodeLine(b, p, err != nil)
+		}
+		if err != nil {
+			break
 		}
 
 		p += int64(len(b))
@@ -121,6 +282,234 @@ func (tf *TextFile) goTo(lineIndex uint) {
 			break
 		}
 	}
+	if len(tf.CachedLines) == 0 {
+		return errLineOutOfRange
+	}
+	return nil
+}
+
+// checkRotated returns errFileRotated if the file got smaller since it was
+// checked by update, as positions of lines are not valid in a truncated or
+// replaced file
+func (tf *TextFile) checkRotated() error {
+	size, known, err := tf.fileSize()
+	if err != nil {
+		return err
+	}
+	if known && size < tf.size {
+		return errFileRotated
+	}
+	return nil
+}
+
+// startIndexing builds index of line positions in background. It is possible
+// only for files which can be read concurrently. Index of a file on disk is
+// loaded from the cache, if the file did not change since it was saved
+func (tf *TextFile) startIndexing() {
+	ra, ok := tf.rs.(io.ReaderAt)
+	if !ok {
+		return
+	}
+	tf.index = newLineIndex(lineIndexInterval)
+	tf.index.enc = tf.enc
+	if f, ok := tf.rs.(diskFile); ok {
+		loadLineIndex(f, ra, tf.index)
+	}
+	go buildLineIndex(tf.rs, tf.index)
+}
+
+// buildLineIndex indexes lines not indexed yet and saves the index in the
+// cache
+func buildLineIndex(rs io.ReadSeeker, index *lineIndex) {
+	ra, ok := rs.(io.ReaderAt)
+	if !ok {
+		return
+	}
+	index.build(ra)
+	if f, ok := rs.(diskFile); ok && index.needsSaving() {
+		saveLineIndex(f, ra, index)
+	}
+}
+
+// checkpoint returns the closest line at or before lineIndex with known
+// position
+func (tf *TextFile) checkpoint(lineIndex uint) (uint, int64) {
+	if tf.index == nil {
+		return 0, 0
+	}
+	return tf.index.checkpoint(lineIndex)
+}
+
+// rowsCount returns number of lines in the file, once it is indexed
+func (tf *TextFile) rowsCount() (uint, bool) {
+	if tf.index == nil {
+		return 0, false
+	}
+	count, known := tf.index.count()
+	// unfinished last line is not indexed
+	if known && tf.sizeKnown && tf.index.end() < tf.size {
+		count++
+	}
+	return count, known
+}
+
+// fileChange tells how the file changed since it was last checked
+type fileChange int
+
+const (
+	fileUnchanged fileChange = iota
+	fileGrew
+	fileTruncated // e.g. by logrotate copytruncate
+	fileRotated   // the file was replaced by a new one
+)
+
+// update checks if the file changed. Lines appended to the file are added to
+// the cache, if there is room for them, and unfinished last line in the cache
+// is read again. If the file was truncated or replaced, the cache is read
+// again from the start of the file
+func (tf *TextFile) update() fileChange {
+	change := fileGrew
+	if r, ok := tf.rs.(rotatable); ok {
+		if rs, rotated := r.reopenIfRotated(); rotated {
+			tf.rs = rs
+			tf.size = 0
+			change = fileRotated
+		}
+	}
+
+	size, known, err := tf.fileSize()
+	if err != nil {
+		tf.err = err
+		return fileUnchanged
+	}
+	if !tf.sizeKnown && change != fileRotated {
+		// end of a decompressed file was read, its contents did not change
+		tf.size = size
+		tf.sizeKnown = known
+		return fileUnchanged
+	}
+	if size < tf.size {
+		change = fileTruncated
+	} else if size == tf.size && change != fileRotated {
+		return fileUnchanged
+	}
+	// encoding of a file is detected again, when it was empty
+	reread := change != fileGrew || tf.size == 0
+	tf.size = size
+	tf.sizeKnown = known
+
+	if reread {
+		tf.detectEncoding()
+		tf.CachedLines = make(map[uint]FileLine)
+		tf.startingLineIndex = 0
+		tf.timeFormatDetected = false
+		if tf.index != nil {
+			tf.startIndexing()
+		}
+		tf.setError(tf.goTo(0))
+	} else {
+		if tf.index != nil {
+			go buildLineIndex(tf.rs, tf.index)
+		}
+		if uint(len(tf.CachedLines)) < tf.cacheSize || tf.hasIncompleteLine() {
+			tf.setError(tf.goTo(tf.startingLineIndex))
+		}
+	}
+	return change
+}
+
+// setError keeps error of reading the file. Lines out of range are not an
+// error, e.g. when reading lines after the last one
+func (tf *TextFile) setError(err error) {
+	if err == errLineOutOfRange {
+		err = nil
+	}
+	tf.err = err
+}
+
+func (tf *TextFile) lastError() error {
+	return tf.err
+}
+
+// hasIncompleteLine tells if the cache holds unfinished last line of the file
+func (tf *TextFile) hasIncompleteLine() bool {
+	line, ok := tf.CachedLines[tf.startingLineIndex+uint(len(tf.CachedLines))-1]
+	return ok && line.incomplete
+}
+
+// lines returns up to count lines starting at line first
+func (tf *TextFile) lines(first uint, count uint) []FileLine {
+	var result []FileLine
+	for uint(len(result)) < count {
+		next := first + uint(len(result))
+		err := tf.goTo(next)
+		tf.setError(err)
+		if err != nil {
+			break
+		}
+		for ; uint(len(result)) < count; next++ {
+			line, ok := tf.CachedLines[next]
+			if !ok {
+				break
+			}
+			result = append(result, line)
+		}
+		if uint(len(tf.CachedLines)) < tf.cacheSize {
+			break
+		}
+	}
+	return result
+}
+
+// matchesAt returns all lines of the file as matching ones, so the file can be
+// an input of filters
+func (tf *TextFile) matchesAt(first uint, count uint) []matchingLine {
+	var result []matchingLine
+	for n, line := range tf.lines(first, count) {
+		result = append(result, matchingLine{index: first + uint(n), position: line.position, incomplete: line.incomplete})
+	}
+	return result
+}
+
+func (tf *TextFile) rowOfLine(lineIndex uint) uint {
+	return lineIndex
+}
+
+// lineAt reads the line starting at given position in the file
+func (tf *TextFile) lineAt(position int64) FileLine {
+	if _, err := tf.rs.Seek(position, io.SeekStart); err != nil {
+		tf.err = &ioError{"seek", err}
+		return FileLine{position: position}
+	}
+	b, err := tf.enc.readLine(bufio.NewReader(tf.rs))
+	if err != nil && err != io.EOF {
+		tf.err = &ioError{"read", err}
+	}
+	return tf.enc.decodeLine(b, position, err != nil)
+}
+
+// linesAt reads lines at positions of the matches. Lines following each other
+// are read after one seek
+func (tf *TextFile) linesAt(matches []matchingLine) []FileLine {
+	var result []FileLine
+	var br *bufio.Reader
+	for n, m := range matches {
+		if br == nil || m.index != matches[n-1].index+1 {
+			br = nil
+			if _, err := tf.rs.Seek(m.position, io.SeekStart); err != nil {
+				tf.err = &ioError{"seek", err}
+				result = append(result, FileLine{position: m.position})
+				continue
+			}
+			br = bufio.NewReader(tf.rs)
+		}
+		b, err := tf.enc.readLine(br)
+		if err != nil && err != io.EOF {
+			tf.err = &ioError{"read", err}
+		}
+		result = append(result, tf.enc.decodeLine(b, m.position, err != nil))
+	}
+	return result
 }
 
 func (tf TextFile) String() string {
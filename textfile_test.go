@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -114,15 +116,18 @@ func TestUnfinishedLineTextFile(t *testing.T) {
 		{
 			startingLineIndex: 0,
 			CacheSize:         1,
-			Lines:             map[uint]FileLine{}},
+			Lines: map[uint]FileLine{
+				0: FileLine{Contents: "1st", position: 0, incomplete: true}}},
 		{
 			startingLineIndex: 0,
 			CacheSize:         2,
-			Lines:             map[uint]FileLine{}},
+			Lines: map[uint]FileLine{
+				0: FileLine{Contents: "1st", position: 0, incomplete: true}}},
 		{
 			startingLineIndex: 0,
 			CacheSize:         3,
-			Lines:             map[uint]FileLine{}},
+			Lines: map[uint]FileLine{
+				0: FileLine{Contents: "1st", position: 0, incomplete: true}}},
 		{
 			startingLineIndex: 1,
 			CacheSize:         1,
@@ -160,7 +165,8 @@ func TestUnfinishedMultilineTextFile(t *testing.T) {
 			CacheSize:         3,
 			Lines: map[uint]FileLine{
 				0: FileLine{Contents: "1st", position: 0},
-				1: FileLine{Contents: "2nd", position: 4}}},
+				1: FileLine{Contents: "2nd", position: 4},
+				2: FileLine{Contents: "3rd", position: 8, incomplete: true}}},
 		{
 			startingLineIndex: 1,
 			CacheSize:         1,
@@ -170,17 +176,136 @@ func TestUnfinishedMultilineTextFile(t *testing.T) {
 			startingLineIndex: 1,
 			CacheSize:         2,
 			Lines: map[uint]FileLine{
-				1: FileLine{Contents: "2nd", position: 4}}},
-
+				1: FileLine{Contents: "2nd", position: 4},
+				2: FileLine{Contents: "3rd", position: 8, incomplete: true}}},
 		{
 			startingLineIndex: 2,
 			CacheSize:         1,
-			Lines:             map[uint]FileLine{}},
+			Lines: map[uint]FileLine{
+				2: FileLine{Contents: "3rd", position: 8, incomplete: true}}},
 		{
 			startingLineIndex: 2,
 			CacheSize:         2,
+			Lines: map[uint]FileLine{
+				2: FileLine{Contents: "3rd", position: 8, incomplete: true}}},
+		{
+			startingLineIndex: 3,
+			CacheSize:         1,
 			Lines:             map[uint]FileLine{}},
 	}
 
 	performTextFileTests(t, testCases, rs)
 }
+
+func TestGrowingTextFile(t *testing.T) {
+	fm := newFileMock("1st\n")
+	tf := NewTextFile(fm, 3)
+
+	if change := tf.update(); change != fileUnchanged {
+		t.Errorf("update() of unchanged file. want: %v, have: %v", fileUnchanged, change)
+	}
+
+	fm.contents += "2nd\n3r"
+	if change := tf.update(); change != fileGrew {
+		t.Errorf("update() of grown file. want: %v, have: %v", fileGrew, change)
+	}
+	expected := map[uint]FileLine{
+		0: FileLine{Contents: "1st", position: 0},
+		1: FileLine{Contents: "2nd", position: 4},
+		2: FileLine{Contents: "3r", position: 8, incomplete: true}}
+	if !reflect.DeepEqual(tf.CachedLines, expected) {
+		t.Errorf("expect: %v, have: %v", expected, tf.CachedLines)
+	}
+
+	// unfinished line is replaced, when it is finished
+	fm.contents += "d\n4th\n"
+	tf.update()
+	expected[2] = FileLine{Contents: "3rd", position: 8}
+	if !reflect.DeepEqual(tf.CachedLines, expected) {
+		t.Errorf("expect: %v, have: %v", expected, tf.CachedLines)
+	}
+}
+
+func TestTruncatedTextFile(t *testing.T) {
+	fm := newFileMock("1st\n2nd\n3rd\n")
+	tf := NewTextFile(fm, 2)
+	tf.goTo(1)
+
+	fm.contents = "new\n"
+	if change := tf.update(); change != fileTruncated {
+		t.Errorf("update() of truncated file. want: %v, have: %v", fileTruncated, change)
+	}
+	expected := map[uint]FileLine{
+		0: FileLine{Contents: "new", position: 0}}
+	if !reflect.DeepEqual(tf.CachedLines, expected) {
+		t.Errorf("expect: %v, have: %v", expected, tf.CachedLines)
+	}
+}
+
+func TestGettingLinePosition(t *testing.T) {
+	rs := newFileMock("1st\n2nd\n\n4th\n5th")
+	testCases := []struct {
+		fromLine   uint
+		fromPos    int64
+		lineOffset int
+		expected   int64
+		err        error
+	}{
+		{4, 13, -1, 9, nil},
+		{4, 13, -2, 8, nil},
+		{4, 13, -4, 0, nil},
+		{4, 13, -5, 0, errLineOutOfRange},
+		{2, 8, 0, 8, nil},
+		{1, 4, -1, 0, nil},
+		{0, 0, 0, 0, nil},
+		{0, 0, -1, 0, errLineOutOfRange},
+		{1, 4, 1, 0, errLineOutOfRange},
+	}
+
+	for n, c := range testCases {
+		observed, err := getLinePosition(rs, utf8Encoding, c.fromLine, c.fromPos, c.lineOffset)
+		if observed != c.expected || err != c.err {
+			t.Errorf("Case %v: want: %v %v, have: %v %v", n, c.expected, c.err, observed, err)
+		}
+	}
+
+	// lines are found also across more reads
+	contents := strings.Repeat("line\n", 200000)
+	rs = newFileMock(contents)
+	if observed, err := getLinePosition(rs, utf8Encoding, 200000, int64(len(contents)), -150000); observed != 250000 || err != nil {
+		t.Errorf("want: 250000, have: %v %v", observed, err)
+	}
+}
+
+func TestTextFileErrors(t *testing.T) {
+	fm := newFileMock("1st\n2nd\n3rd\n")
+	tf := NewTextFile(fm, 2)
+
+	if err := tf.goTo(3); err != errLineOutOfRange {
+		t.Errorf("goTo() after the last line. want: %v, have: %v", errLineOutOfRange, err)
+	}
+	if lines := tf.lines(3, 2); len(lines) != 0 || tf.lastError() != nil {
+		t.Errorf("lines() after the last line. want: no lines and no error, have: %v %v", lines, tf.lastError())
+	}
+
+	fm.contents = "new\n"
+	if err := tf.goTo(1); err != errFileRotated {
+		t.Errorf("goTo() in truncated file. want: %v, have: %v", errFileRotated, err)
+	}
+	tf.update()
+
+	failure := errors.New("stale NFS file handle")
+	fm.err = failure
+	err := tf.goTo(0)
+	if !errors.Is(err, errIO) || !errors.Is(err, failure) {
+		t.Errorf("goTo() of failing file. want: %v, have: %v", errIO, err)
+	}
+	if lines := tf.lines(0, 2); len(lines) != 0 || !errors.Is(tf.lastError(), failure) {
+		t.Errorf("lines() of failing file. want: no lines and error, have: %v %v", lines, tf.lastError())
+	}
+
+	fm.err = nil
+	if lines := tf.lines(0, 2); len(lines) != 1 || tf.lastError() != nil {
+		t.Errorf("lines() of recovered file. want: 1 line and no error, have: %v %v", lines, tf.lastError())
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// newSearchPattern returns regexp of searched text. Text in slashes is a
+// regexp, other text is found literally, ignoring case if it is in lower case
+func newSearchPattern(text string) (*regexp.Regexp, error) {
+	if len(text) > 1 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		return regexp.Compile(text[1 : len(text)-1])
+	}
+	pattern := regexp.QuoteMeta(text)
+	if text == strings.ToLower(text) {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// textSearch finds lines of the file containing the pattern, so the view can
+// go from one to another. The whole file is searched in background
+type textSearch struct {
+	pattern *regexp.Regexp
+	found   *matchingLines
+	current int // row of the last shown match, -1 before going to one
+}
+
+func newTextSearch(tf *TextFile, pattern *regexp.Regexp) *textSearch {
+	result := &textSearch{}
+	result.pattern = pattern
+	result.found = newMatchingLines(tf, func(line FileLine) bool {
+		return pattern.MatchString(line.Contents)
+	})
+	result.current = -1
+	return result
+}
+
+// first returns the first match at the position or after it
+func (ts *textSearch) first(position int64) (matchingLine, bool) {
+	return ts.at(int(ts.found.rowOfPosition(position)))
+}
+
+// next returns the first match after the position and the last shown match
+func (ts *textSearch) next(position int64) (matchingLine, bool) {
+	if m, ok := ts.shown(); ok && m.position > position {
+		position = m.position
+	}
+	return ts.first(position + 1)
+}
+
+// previous returns the last match before the position and the last shown
+// match
+func (ts *textSearch) previous(position int64) (matchingLine, bool) {
+	if m, ok := ts.shown(); ok && m.position < position {
+		position = m.position
+	}
+	return ts.at(int(ts.found.rowOfPosition(position)) - 1)
+}
+
+// shown returns the last shown match
+func (ts *textSearch) shown() (matchingLine, bool) {
+	if ts.current < 0 {
+		return matchingLine{}, false
+	}
+	matches := ts.found.matchesAt(uint(ts.current), 1)
+	if len(matches) == 0 {
+		return matchingLine{}, false
+	}
+	return matches[0], true
+}
+
+// at returns match of given row and makes it the shown one
+func (ts *textSearch) at(row int) (matchingLine, bool) {
+	if row < 0 {
+		return matchingLine{}, false
+	}
+	matches := ts.found.matchesAt(uint(row), 1)
+	if len(matches) == 0 {
+		return matchingLine{}, false
+	}
+	ts.current = row
+	return matches[0], true
+}
+
+// counter describes the shown match, like "match 3 of 10". Number of matches
+// is given once the whole file was searched
+func (ts *textSearch) counter() string {
+	count, known := ts.found.rowsCount()
+	switch {
+	case ts.current >= 0 && known:
+		return fmt.Sprintf("match %v of %v", ts.current+1, count)
+	case ts.current >= 0:
+		return fmt.Sprintf("match %v", ts.current+1)
+	case known:
+		return fmt.Sprintf("%v matches", count)
+	}
+	return ""
+}
+
+// stop cancels searching the file
+func (ts *textSearch) stop() {
+	ts.found.stop()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSearchPattern(t *testing.T) {
+	testCases := []struct {
+		text     string
+		line     string
+		expected bool
+	}{
+		{"timeout", "Read TIMEOUT", true},
+		{"Timeout", "Read TIMEOUT", false},
+		{"Timeout", "Read Timeout", true},
+		{"a.b", "axb", false},
+		{"/a.b/", "axb", true},
+		{"/", "a/b", true},
+	}
+
+	for n, c := range testCases {
+		pattern, err := newSearchPattern(c.text)
+		if err != nil {
+			t.Fatalf("Case %v: %v", n, err)
+		}
+		if observed := pattern.MatchString(c.line); observed != c.expected {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.expected, observed)
+		}
+	}
+	if _, err := newSearchPattern("/(/"); err == nil {
+		t.Errorf("invalid regexp is accepted")
+	}
+}
+
+func TestGoingToMatches(t *testing.T) {
+	defer func(size int64) { searchChunkSize = size }(searchChunkSize)
+	searchChunkSize = 100
+
+	// lines have 11 bytes, every tenth one matches
+	var sb strings.Builder
+	for i := 0; i < 1000; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&sb, "%04d match\n", i)
+		} else {
+			fmt.Fprintf(&sb, "%04d other\n", i)
+		}
+	}
+	pattern, _ := newSearchPattern("match")
+	ts := newTextSearch(NewTextFile(newFileMock(sb.String()), 10), pattern)
+
+	steps := []struct {
+		find     func(position int64) (matchingLine, bool)
+		position int64
+		expected uint // index of the found line
+		counter  string
+	}{
+		{ts.first, 11 * 15, 20, "match 3 of 100"},
+		{ts.next, 11 * 20, 30, "match 4 of 100"},
+		// shown match is below the position, e.g. at the end of the view
+		{ts.next, 11 * 25, 40, "match 5 of 100"},
+		{ts.previous, 11 * 40, 30, "match 4 of 100"},
+		{ts.previous, 11 * 30, 20, "match 3 of 100"},
+		{ts.first, 0, 0, "match 1 of 100"},
+		{ts.next, 11 * 985, 990, "match 100 of 100"},
+	}
+	for n, s := range steps {
+		m, ok := s.find(s.position)
+		if !ok || m.index != s.expected || m.position != int64(11*s.expected) || ts.counter() != s.counter {
+			t.Errorf("Case %v: want: %v %v, have: %v %v %v", n, s.expected, s.counter, m, ok, ts.counter())
+		}
+	}
+
+	if _, ok := ts.next(11 * 990); ok {
+		t.Errorf("match after the last one is found")
+	}
+	ts.first(0)
+	if _, ok := ts.previous(0); ok {
+		t.Errorf("match before the first one is found")
+	}
+}
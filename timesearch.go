@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"time"
+)
+
+// timeSearchLinearSize is size of the part of the file, which is searched
+// line by line instead of bisecting it
+const timeSearchLinearSize = 64 * 1024
+
+// timeDetectionLines is number of lines used to detect the timestamp format
+const timeDetectionLines = 64
+
+// lineReader reads lines of the file starting at given position
+type lineReader struct {
+	r   *bufio.Reader
+	enc *textEncoding
+	pos int64 // position of the next line
+}
+
+func newLineReader(ra io.ReaderAt, pos int64, enc *textEncoding) *lineReader {
+	result := &lineReader{}
+	result.r = bufio.NewReader(io.NewSectionReader(ra, pos, math.MaxInt64-pos))
+	result.enc = enc
+	result.pos = pos
+	return result
+}
+
+// next returns the next line and its position
+func (lr *lineReader) next() (FileLine, bool) {
+	b, err := lr.enc.readLine(lr.r)
+	if err != nil {
+		return FileLine{}, false
+	}
+	line := FileLine{Contents: lr.enc.decode(b, lr.pos), position: lr.pos}
+	lr.pos += int64(len(b))
+	return line, true
+}
+
+// readerAt returns reader of the file, which is safe for concurrent use
+func (tf *TextFile) readerAt() io.ReaderAt {
+	if ra, ok := tf.rs.(io.ReaderAt); ok {
+		return ra
+	}
+	return &seekingReaderAt{rs: tf.rs}
+}
+
+// firstLines returns contents of up to count first lines of the file
+func (tf *TextFile) firstLines(count int) []string {
+	var result []string
+	lr := newLineReader(tf.readerAt(), 0, tf.enc)
+	for len(result) < count {
+		line, ok := lr.next()
+		if !ok {
+			break
+		}
+		result = append(result, line.Contents)
+	}
+	return result
+}
+
+// timeOf returns time of the line given by its time field, if the file is a
+// structured log, or by its timestamp in the timestamp format of the file. The
+// format is detected from the first lines of the file. Until there are enough
+// lines to detect it, all known formats are tried
+func (tf *TextFile) timeOf(line FileLine) (time.Time, bool) {
+	if tf.logFormat != nil {
+		if t, ok := tf.logFormat.timeOf(line.Contents); ok {
+			return t, true
+		}
+	}
+	if !tf.timeFormatDetected {
+		sample := tf.firstLines(timeDetectionLines)
+		tf.timeFormat = detectTimestampFormat(sample)
+		tf.timeFormatDetected = len(sample) == timeDetectionLines
+	}
+	if tf.timeFormat == nil {
+		return parseTimestamp(line.Contents)
+	}
+	return tf.timeFormat.parse(line.Contents)
+}
+
+// nextTimedLine returns the next line of the reader with a timestamp, which
+// starts before end. The reader is at the following line then
+func (tf *TextFile) nextTimedLine(lr *lineReader, end int64) (timedLine, bool) {
+	for lr.pos < end {
+		line, ok := lr.next()
+		if !ok {
+			break
+		}
+		if t, ok := tf.timeOf(line); ok {
+			return timedLine{line, t}, true
+		}
+	}
+	return timedLine{}, false
+}
+
+// positionOfTime returns position of the first line with a timestamp not
+// before t, or size of the file if there is no such line, math.MaxInt64 if the
+// size is not known. Lines without a timestamp, e.g. stack traces, are
+// skipped. Lines are expected to be in order of time. A file of unknown size
+// is read line by line up to the found line, instead of finding its end
+func (tf *TextFile) positionOfTime(t time.Time) int64 {
+	ra := tf.readerAt()
+	// the line starts between lo and hi, both are positions of a line start,
+	// or it is the found one
+	lo, hi := int64(0), tf.size
+	if !tf.sizeKnown {
+		hi = math.MaxInt64
+	}
+	found := hi
+	for tf.sizeKnown && hi-lo > timeSearchLinearSize {
+		start, ok := lineStartAfter(ra, lo+(hi-lo)/2, hi, tf.enc)
+		if !ok {
+			break
+		}
+		lr := newLineReader(ra, start, tf.enc)
+		line, ok := tf.nextTimedLine(lr, hi)
+		switch {
+		case !ok:
+			hi = start
+		case line.time.Before(t):
+			lo = lr.pos
+		default:
+			hi = line.position
+			found = hi
+		}
+	}
+	lr := newLineReader(ra, lo, tf.enc)
+	for {
+		line, ok := tf.nextTimedLine(lr, hi)
+		if !ok {
+			return found
+		}
+		if !line.time.Before(t) {
+			return line.position
+		}
+	}
+}
+
+// lineStartAfter returns position of the first line starting after pos and
+// before end
+func lineStartAfter(ra io.ReaderAt, pos int64, end int64, enc *textEncoding) (int64, bool) {
+	pos = enc.align(pos)
+	if pos >= end {
+		return 0, false
+	}
+	r := bufio.NewReaderSize(io.NewSectionReader(ra, pos, end-pos), 4096)
+	b, err := enc.readLine(r)
+	if err != nil {
+		return 0, false
+	}
+	start := pos + int64(len(b))
+	return start, start < end
+}
+
+// lineOfPosition returns index of the line starting at the position
+func (tf *TextFile) lineOfPosition(position int64) uint {
+	var lineIndex uint
+	var pos int64
+	if tf.index != nil {
+		lineIndex, pos = tf.index.checkpointBefore(position)
+	}
+	ra := tf.readerAt()
+	b := make([]byte, 64*1024)
+	var prev byte
+	for pos < position {
+		n, err := ra.ReadAt(b[:Min(int64(len(b)), position-pos)], pos)
+		tf.enc.lineEnds(b[:n], pos, prev, func(int64) { lineIndex++ })
+		pos += int64(n)
+		if n != 0 {
+			prev = b[n-1]
+		}
+		if err != nil {
+			break
+		}
+	}
+	return lineIndex
+}
+
+// lineOfTime returns index of the first line with a timestamp not before t
+func (tf *TextFile) lineOfTime(t time.Time) uint {
+	return tf.lineOfPosition(tf.positionOfTime(t))
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timedLogContents returns lines with a timestamp every second, followed by
+// stack traces, and lines of each timestamped one
+func timedLogContents(linesCount int, format func(t time.Time) string) (string, []uint) {
+	var sb strings.Builder
+	var lines []uint
+	lineIndex := uint(0)
+	start := time.Date(2019, 11, 25, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < linesCount; i++ {
+		fmt.Fprintf(&sb, "%v request %v\n", format(start.Add(time.Duration(i)*time.Second)), i)
+		lines = append(lines, lineIndex)
+		lineIndex++
+		for j := 0; j < i%4; j++ {
+			fmt.Fprintf(&sb, "  at frame %v\n", j)
+			lineIndex++
+		}
+	}
+	return sb.String(), lines
+}
+
+func TestGoingToTime(t *testing.T) {
+	formats := map[string]func(t time.Time) string{
+		"java":  func(t time.Time) string { return t.Format("2006-01-02 15:04:05,000") },
+		"clf":   func(t time.Time) string { return t.Format("host - - [02/Jan/2006:15:04:05 -0700]") },
+		"epoch": func(t time.Time) string { return fmt.Sprint(t.Unix()) },
+	}
+	start := time.Date(2019, 11, 25, 10, 0, 0, 0, time.UTC)
+
+	for name, format := range formats {
+		contents, lines := timedLogContents(5000, format)
+		for _, indexed := range []bool{false, true} {
+			tf := NewTextFile(newFileMock(contents), 10)
+			if indexed {
+				tf.startIndexing()
+				tf.index.build(tf.readerAt())
+			}
+			testCases := []struct {
+				time     time.Time
+				expected uint
+			}{
+				{start.Add(-time.Hour), 0},
+				{start, lines[0]},
+				{start.Add(1234 * time.Second), lines[1234]},
+				{start.Add(1234*time.Second + time.Millisecond), lines[1235]},
+				{start.Add(4999 * time.Second), lines[4999]},
+				{start.Add(5000 * time.Second), uint(strings.Count(contents, "\n"))},
+			}
+			for n, c := range testCases {
+				if observed := tf.lineOfTime(c.time); observed != c.expected {
+					t.Errorf("Case %v %v indexed %v: want: %v, have: %v", name, n, indexed, c.expected, observed)
+				}
+			}
+		}
+	}
+}
+
+func TestGoingToTimeAcrossLinesWithoutTimestamps(t *testing.T) {
+	untimed := strings.Repeat("  at frame\n", 10000)
+	testCases := []struct {
+		contents string
+		time     string
+		expected uint
+	}{
+		{untimed, "2019-11-25T10:00:00Z", 10000},
+		{"2019-11-25T10:00:00Z a\n" + untimed + "2019-11-25T10:00:02Z b\n" + untimed, "2019-11-25T10:00:01Z", 10001},
+		{"2019-11-25T10:00:00Z a\n" + untimed + "2019-11-25T10:00:02Z b\n" + untimed, "2019-11-25T10:00:03Z", 20002},
+		{untimed + "2019-11-25T10:00:02Z b\n", "2019-11-25T10:00:00Z", 10000},
+	}
+
+	for n, c := range testCases {
+		at, _ := time.Parse(time.RFC3339, c.time)
+		tf := NewTextFile(newFileMock(c.contents), 10)
+		if observed := tf.lineOfTime(at); observed != c.expected {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.expected, observed)
+		}
+	}
+}
+
+func TestGoingToTimeOfStructuredLog(t *testing.T) {
+	contents, lines := timedLogContents(3000, func(t time.Time) string {
+		return fmt.Sprintf(`<14>1 %v host app - - -`, t.Format(time.RFC3339))
+	})
+	tf := NewTextFile(newFileMock(contents), 10)
+	tf.logFormat, _ = findLogFormat("syslog")
+	at := time.Date(2019, 11, 25, 10, 30, 0, 0, time.UTC)
+	if observed := tf.lineOfTime(at); observed != lines[1800] {
+		t.Errorf("want: %v, have: %v", lines[1800], observed)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeNow returns current time, it is replaced in tests
+var timeNow = time.Now
+
+// timestampFormat recognizes timestamps of one format at start of the line
+type timestampFormat struct {
+	name  string
+	parse func(contents string) (time.Time, bool)
+}
+
+// timestampFormats are formats tried when detecting format of a file
+var timestampFormats = []*timestampFormat{
+	{"iso8601", parseISOTimestamp},
+	{"syslog", parseSyslogTimestamp},
+	{"clf", parseCLFTimestamp},
+	{"epoch", parseEpochTimestamp},
+}
+
+// isoTimestampPattern matches ISO 8601 timestamp at start of the line, also
+// in brackets and with a space instead of T. It covers RFC 3339 and the Java
+// "yyyy-MM-dd HH:mm:ss,SSS" format
+var isoTimestampPattern = regexp.MustCompile(
+	`^\[?(\d{4}-\d{2}-\d{2})[T ](\d{2}:\d{2}:\d{2}(?:[.,]\d+)?)(Z|[+-]\d{2}:?\d{2})?`)
+
+// syslogTimestampPattern matches "Jan _2 15:04:05" timestamp of BSD syslog
+var syslogTimestampPattern = regexp.MustCompile(
+	`^([A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2})(?:\.(\d+))?`)
+
+// clfTimestampPattern matches timestamp of the Apache common log format,
+// optionally preceded by host, ident and user fields
+var clfTimestampPattern = regexp.MustCompile(
+	`^(?:\S+ \S+ \S+ )?\[(\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`)
+
+// epochTimestampPattern matches Unix time in seconds, optionally with
+// fraction, or in milliseconds
+var epochTimestampPattern = regexp.MustCompile(`^\[?(\d{10}|\d{13})(?:\.(\d{1,9}))?\b`)
+
+// parseTimestamp returns time of the line in any of the known formats.
+// Timestamps without time zone are taken as UTC
+func parseTimestamp(contents string) (time.Time, bool) {
+	for _, format := range timestampFormats {
+		if t, ok := format.parse(contents); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseISOTimestamp(contents string) (time.Time, bool) {
+	m := isoTimestampPattern.FindStringSubmatch(contents)
+	if m == nil {
+		return time.Time{}, false
+	}
+	text := m[1] + "T" + strings.Replace(m[2], ",", ".", 1)
+	layout := "2006-01-02T15:04:05.999999999"
+	switch {
+	case m[3] == "Z" || strings.Contains(m[3], ":"):
+		text += m[3]
+		layout += "Z07:00"
+	case m[3] != "":
+		text += m[3]
+		layout += "Z0700"
+	}
+	t, err := time.Parse(layout, text)
+	return t, err == nil
+}
+
+// parseSyslogTimestamp takes the timestamp to be from the last year, if it
+// would be in the future otherwise
+func parseSyslogTimestamp(contents string) (time.Time, bool) {
+	m := syslogTimestampPattern.FindStringSubmatch(contents)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("Jan _2 15:04:05", m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	now := timeNow().UTC()
+	t = t.AddDate(now.Year(), 0, 0).Add(fraction(m[2]))
+	if t.After(now.AddDate(0, 0, 1)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+func parseCLFTimestamp(contents string) (time.Time, bool) {
+	m := clfTimestampPattern.FindStringSubmatch(contents)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[1])
+	return t, err == nil
+}
+
+func parseEpochTimestamp(contents string) (time.Time, bool) {
+	m := epochTimestampPattern.FindStringSubmatch(contents)
+	if m == nil {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if len(m[1]) == 13 {
+		return time.Unix(0, n*int64(time.Millisecond)).UTC(), m[2] == ""
+	}
+	return time.Unix(n, 0).Add(fraction(m[2])).UTC(), true
+}
+
+// fraction returns duration of the digits following a decimal point
+func fraction(digits string) time.Duration {
+	if len(digits) > 9 {
+		digits = digits[:9]
+	}
+	n, _ := strconv.Atoi((digits + "000000000")[:9])
+	return time.Duration(n)
+}
+
+// detectTimestampFormat returns format of the most lines, nil if no line has
+// a timestamp
+func detectTimestampFormat(lines []string) *timestampFormat {
+	var result *timestampFormat
+	best := 0
+	for _, format := range timestampFormats {
+		count := 0
+		for _, line := range lines {
+			if _, ok := format.parse(line); ok {
+				count++
+			}
+		}
+		if count > best {
+			result = format
+			best = count
+		}
+	}
+	return result
+}
+
+// parseTimeArg parses time given by the user, in any of the known formats or
+// as a date
+func parseTimeArg(text string) (time.Time, error) {
+	if t, ok := parseTimestamp(text); ok {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", text)
+}
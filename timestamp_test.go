@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsingTimestamps(t *testing.T) {
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Date(2020, 1, 10, 12, 0, 0, 0, time.UTC) }
+
+	testCases := []struct {
+		contents string
+		expected string // in RFC 3339, empty if there is no timestamp
+	}{
+		{"2019-11-25T10:00:01Z started", "2019-11-25T10:00:01Z"},
+		{"2019-11-25 10:00:01,250 INFO started", "2019-11-25T10:00:01.25Z"},
+		{"[2019-11-25 10:00:01.5] started", "2019-11-25T10:00:01.5Z"},
+		{"2019-11-25T10:00:01+02:00 started", "2019-11-25T08:00:01Z"},
+		{"2019-11-25T10:00:01-0130 started", "2019-11-25T11:30:01Z"},
+		{"Jan  9 10:00:01 host sshd[42]: accepted", "2020-01-09T10:00:01Z"},
+		{"Jan 11 10:00:01.5 host cron: started", "2020-01-11T10:00:01.5Z"},
+		{"Dec 31 23:59:59 host kernel: panic", "2019-12-31T23:59:59Z"},
+		{`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200`, "2000-10-10T20:55:36Z"},
+		{"[10/Oct/2000:13:55:36 +0000] started", "2000-10-10T13:55:36Z"},
+		{"1574676001 started", "2019-11-25T10:00:01Z"},
+		{"1574676001.25 started", "2019-11-25T10:00:01.25Z"},
+		{"[1574676001250] started", "2019-11-25T10:00:01.25Z"},
+		{"  at stack", ""},
+		{"157467600 short number", ""},
+		{"15746760012 long number", ""},
+		{"Foo 11 10:00:01 invalid month", ""},
+		{"2019-11-25 started", ""},
+		{"2019-13-25T10:00:01Z invalid month", ""},
+	}
+
+	for n, c := range testCases {
+		observed, ok := parseTimestamp(c.contents)
+		if c.expected == "" {
+			if ok {
+				t.Errorf("Case %v: %q want: no timestamp, have: %v", n, c.contents, observed)
+			}
+			continue
+		}
+		expected, _ := time.Parse(time.RFC3339Nano, c.expected)
+		if !ok || !observed.Equal(expected) {
+			t.Errorf("Case %v: %q want: %v, have: %v %v", n, c.contents, expected, observed, ok)
+		}
+	}
+}
+
+func TestDetectingTimestampFormat(t *testing.T) {
+	testCases := []struct {
+		lines    []string
+		expected string // name of the format, empty if none
+	}{
+		{[]string{"2019-11-25 10:00:01,250 INFO a", "  at stack", "2019-11-25 10:00:02,000 INFO b"}, "iso8601"},
+		{[]string{"Nov 25 10:00:01 host a", "1574676001 looks like epoch", "Nov 25 10:00:02 host b"}, "syslog"},
+		{[]string{`h - - [25/Nov/2019:10:00:01 +0000] "GET /"`}, "clf"},
+		{[]string{"1574676001250 a", "1574676001251 b"}, "epoch"},
+		{[]string{"no timestamps", "at all"}, ""},
+		{nil, ""},
+	}
+
+	for n, c := range testCases {
+		observed := ""
+		if format := detectTimestampFormat(c.lines); format != nil {
+			observed = format.name
+		}
+		if observed != c.expected {
+			t.Errorf("Case %v: want: %q, have: %q", n, c.expected, observed)
+		}
+	}
+}
@@ -0,0 +1,765 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/marcusolsson/tui-go"
+)
+
+// followInterval is how often files are checked for new lines in follow mode
+const followInterval = 500 * time.Millisecond
+
+// defaultWidth is width of the view assumed before it is shown
+const defaultWidth = 80
+
+// lastColumnStretch is how many times the last column of structured logs is
+// wider than others
+const lastColumnStretch = 4
+
+// horizontalScrollStep is number of columns scrolled by Left and Right keys
+const horizontalScrollStep = 8
+
+// sourceColors are colors of lines of files in the merged view
+var sourceColors = []tui.Color{tui.ColorCyan, tui.ColorGreen, tui.ColorYellow, tui.ColorMagenta, tui.ColorRed, tui.ColorBlue}
+
+var errNoFilters = errors.New("filters are not available in the merged view")
+
+var errNoTimestamps = errors.New("lines of the view can not be found by time")
+
+var errNoSearch = errors.New("search is not available in the merged view")
+
+var errNoMatch = errors.New("pattern not found")
+
+var errNoMatchColumn = errors.New("match is not in the last column")
+
+type fileView struct {
+	name      string
+	filters   *filterStack // filters of shown lines, source of the pager; nil in the merged view
+	p         *pager
+	fileLines *tui.Table
+	marker    string        // shown above the first line, e.g. when the file was rotated
+	format    *logFormat    // format of structured logs shown in columns, nil for plain text
+	columns   []string      // fields shown as columns
+	search    *textSearch   // highlighted text, nil if none
+	renderer  *textRenderer // shared by all views
+	wrap      bool          // long lines take more rows, otherwise they are cut at the screen
+	offset    int           // first shown column of the last column, when lines are not wrapped
+	width     int           // width of the table, when the lines were rendered
+}
+
+func newFileView(name string, filters *filterStack, p *pager) *fileView {
+	result := &fileView{}
+	result.name = name
+	result.filters = filters
+	result.p = p
+	result.renderer = newTextRenderer(true, defaultTabWidth)
+	result.fileLines = tui.NewTable(0, 0)
+	result.fileLines.SetSizePolicy(tui.Expanding, tui.Expanding)
+	result.render()
+	return result
+}
+
+// render replaces rows of the table with currently visible lines. Lines are
+// colored by their level, with tokens like numbers and timestamps highlighted.
+// Control characters are shown as escapes, so they do not break the layout
+func (fv *fileView) render() {
+	fv.fileLines.RemoveRows()
+	fv.width = fv.screenWidth()
+	if fv.marker != "" && fv.p.firstLine() == 0 {
+		fv.fileLines.AppendRow(tui.NewLabel(fv.marker))
+	}
+	var pattern *regexp.Regexp
+	if fv.search != nil {
+		pattern = fv.search.pattern
+	}
+	var rowsCount uint
+	for _, line := range fv.p.visibleLines() {
+		columns, style := fv.lineColumns(line, pattern)
+		for _, spans := range fv.screenRows(columns) {
+			// the last wrapped line may not fit
+			if rowsCount == fv.p.visibleCount {
+				return
+			}
+			var row []tui.Widget
+			for _, s := range spans {
+				row = append(row, newHighlightedLabel(s, style))
+			}
+			fv.fileLines.AppendRow(row...)
+			rowsCount++
+		}
+	}
+}
+
+// lineColumns returns spans of texts shown in columns of the line and style
+// of the line
+func (fv *fileView) lineColumns(line FileLine, pattern *regexp.Regexp) ([][]highlightSpan, string) {
+	texts := []string{line.rawContents()}
+	if fv.format != nil {
+		texts = fv.format.columnValues(line, fv.columns)
+	}
+	mf, merged := fv.p.src.(*mergedFile)
+	style := levelStyles[lineLevel(fv.format, line)]
+	switch {
+	case merged:
+		style = fmt.Sprintf("source%v", line.source%len(sourceColors))
+	case line.isContext:
+		style = "context"
+	}
+	var result [][]highlightSpan
+	for n, text := range texts {
+		spans := fv.renderer.spans(text, pattern)
+		if merged && n == 0 {
+			spans = append([]highlightSpan{{mf.tag(line), ""}}, spans...)
+		}
+		result = append(result, spans)
+	}
+	return result, style
+}
+
+// screenRows returns rows of the table showing the columns of a line. Wrapped
+// columns take as many rows as needed, otherwise the last column is scrolled
+// horizontally by the offset
+func (fv *fileView) screenRows(columns [][]highlightSpan) [][][]highlightSpan {
+	last := len(columns) - 1
+	if !fv.wrap {
+		columns[last] = cutSpans(columns[last], fv.offset, -1)
+		return [][][]highlightSpan{columns}
+	}
+	widths := fv.columnWidths()
+	var result [][][]highlightSpan
+	for n, spans := range columns {
+		for r, part := range wrapSpans(spans, widths[n]) {
+			if r == len(result) {
+				row := make([][]highlightSpan, len(columns))
+				for i := range row {
+					row[i] = []highlightSpan{{"", ""}}
+				}
+				result = append(result, row)
+			}
+			result[r][n] = part
+		}
+	}
+	return result
+}
+
+// screenWidth returns width of the table on the screen
+func (fv *fileView) screenWidth() int {
+	if width := fv.fileLines.Size().X; width > 0 {
+		return width
+	}
+	return defaultWidth
+}
+
+// columnWidths returns widths of columns of the table, given by their stretch
+func (fv *fileView) columnWidths() []int {
+	if len(fv.columns) == 0 {
+		return []int{fv.width}
+	}
+	stretch := len(fv.columns) - 1 + lastColumnStretch
+	result := make([]int, len(fv.columns))
+	rest := fv.width
+	for n := 0; n < len(result)-1; n++ {
+		result[n] = fv.width / stretch
+		if result[n] == 0 {
+			result[n] = 1
+		}
+		rest -= result[n]
+	}
+	if rest < 1 {
+		rest = 1
+	}
+	result[len(result)-1] = rest
+	return result
+}
+
+// toggleWrap wraps long lines into more rows or cuts them at the screen.
+// Pager scrolls by lines, so it is given number of rows of each line
+func (fv *fileView) toggleWrap() {
+	fv.wrap = !fv.wrap
+	fv.offset = 0
+	if fv.wrap {
+		fv.p.lineRows = func(line FileLine) uint {
+			columns, _ := fv.lineColumns(line, nil)
+			return uint(len(fv.screenRows(columns)))
+		}
+	} else {
+		fv.p.lineRows = nil
+	}
+	if !fv.p.hasMoreLines() {
+		fv.p.end()
+	}
+	fv.render()
+}
+
+// scrollHorizontally scrolls lines which are not wrapped by count columns to
+// the right, or to the left for negative count, up to the end of the longest
+// visible line
+func (fv *fileView) scrollHorizontally(count int) {
+	if fv.wrap {
+		return
+	}
+	longest := 0
+	for _, line := range fv.p.visibleLines() {
+		columns, _ := fv.lineColumns(line, nil)
+		if width := spansWidth(columns[len(columns)-1]); width > longest {
+			longest = width
+		}
+	}
+	widths := fv.columnWidths()
+	maxOffset := longest - widths[len(widths)-1]
+	fv.offset += count
+	if fv.offset > maxOffset {
+		fv.offset = maxOffset
+	}
+	if fv.offset < 0 {
+		fv.offset = 0
+	}
+	fv.render()
+}
+
+// showMatchColumn scrolls horizontally to the first occurrence of the
+// searched text in the line of the shown match. Wrapping is turned off, as
+// wrapped lines are not scrolled
+func (fv *fileView) showMatchColumn() error {
+	if fv.search == nil {
+		return nil
+	}
+	m, ok := fv.search.shown()
+	if !ok {
+		return errNoMatch
+	}
+	line, ok := fv.visibleLine(m.position)
+	if !ok {
+		fv.p.goToLine(m.index)
+		if line, ok = fv.visibleLine(m.position); !ok {
+			return errNoMatch
+		}
+	}
+	columns, _ := fv.lineColumns(line, fv.search.pattern)
+	column, ok := matchColumn(columns[len(columns)-1])
+	if !ok {
+		return errNoMatchColumn
+	}
+	if fv.wrap {
+		fv.toggleWrap()
+	}
+	widths := fv.columnWidths()
+	fv.offset = 0
+	if width := widths[len(widths)-1]; column >= width {
+		// a part of the line before the match is kept for context
+		fv.offset = column - width/4
+	}
+	fv.render()
+	return nil
+}
+
+// visibleLine returns the visible line at the position
+func (fv *fileView) visibleLine(position int64) (FileLine, bool) {
+	for _, line := range fv.p.visibleLines() {
+		if line.position == position {
+			return line, true
+		}
+	}
+	return FileLine{}, false
+}
+
+// newHighlightedLabel returns widget showing the spans, the ones without a
+// style of their own in given style
+func newHighlightedLabel(spans []highlightSpan, style string) tui.Widget {
+	newLabel := func(span highlightSpan) *tui.Label {
+		label := tui.NewLabel(span.text)
+		if span.style != "" {
+			label.SetStyleName(span.style)
+		} else if style != "" {
+			label.SetStyleName(style)
+		}
+		return label
+	}
+	if len(spans) == 1 {
+		return newLabel(spans[0])
+	}
+	box := tui.NewHBox()
+	for _, span := range spans {
+		box.Append(newLabel(span))
+	}
+	box.Append(tui.NewSpacer())
+	return box
+}
+
+// setColumns shows fields of structured log lines in columns, the last one
+// is the widest
+func (fv *fileView) setColumns(format *logFormat, columns []string) {
+	if format == nil {
+		return
+	}
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	fv.format = format
+	fv.columns = columns
+	fv.fileLines = tui.NewTable(len(columns), 0)
+	fv.fileLines.SetSizePolicy(tui.Expanding, tui.Expanding)
+	for n := range columns {
+		fv.fileLines.SetColumnStretch(n, 1)
+	}
+	fv.fileLines.SetColumnStretch(len(columns)-1, lastColumnStretch)
+	fv.render()
+}
+
+// pushFilter narrows shown lines to the ones matching the filter expression
+func (fv *fileView) pushFilter(expression string) error {
+	if fv.filters == nil {
+		return errNoFilters
+	}
+	if err := fv.filters.push(expression); err != nil {
+		return err
+	}
+	fv.filtersChanged()
+	return nil
+}
+
+// popFilter removes the last added filter
+func (fv *fileView) popFilter() {
+	if fv.filters == nil {
+		return
+	}
+	fv.filters.pop()
+	fv.filtersChanged()
+}
+
+// toggleFilter disables or enables the filter of given layer
+func (fv *fileView) toggleFilter(layer int) {
+	if fv.filters == nil {
+		return
+	}
+	fv.filters.toggle(layer)
+	fv.filtersChanged()
+}
+
+// recordStart tells if the line starts a record, by default if it has a
+// timestamp
+func (fv *fileView) recordStart() func(FileLine) bool {
+	if fv.filters != nil && fv.filters.recordStart != nil {
+		return fv.filters.recordStart
+	}
+	return func(line FileLine) bool {
+		_, ok := parseTimestamp(line.Contents)
+		return ok
+	}
+}
+
+// goToTime shows the first line with a timestamp not before given time
+func (fv *fileView) goToTime(text string) error {
+	ts, ok := fv.p.src.(timed)
+	if !ok {
+		return errNoTimestamps
+	}
+	t, err := parseTimeArg(text)
+	if err != nil {
+		return fmt.Errorf("invalid time %q", text)
+	}
+	fv.p.goToLine(ts.lineOfTime(t))
+	fv.render()
+	return nil
+}
+
+// setSearch highlights occurrences of the text and searches the file for
+// them, empty text ends the search
+func (fv *fileView) setSearch(text string) error {
+	if fv.filters == nil {
+		return errNoSearch
+	}
+	var pattern *regexp.Regexp
+	if text != "" {
+		var err error
+		if pattern, err = newSearchPattern(text); err != nil {
+			return err
+		}
+	}
+	if fv.search != nil {
+		fv.search.stop()
+		fv.search = nil
+	}
+	if pattern != nil {
+		fv.search = newTextSearch(fv.filters.tf, pattern)
+	}
+	fv.render()
+	return nil
+}
+
+// topPosition returns position of the first visible line, -1 if there is none
+func (fv *fileView) topPosition() int64 {
+	lines := fv.p.visibleLines()
+	if len(lines) == 0 {
+		return -1
+	}
+	return lines[0].position
+}
+
+// showMatch shows the line of the match at the top, if it is not hidden by
+// filters
+func (fv *fileView) showMatch(m matchingLine, ok bool) error {
+	if !ok {
+		return errNoMatch
+	}
+	fv.p.goToLine(m.index)
+	fv.render()
+	return nil
+}
+
+// startSearch goes to the first occurrence of the text at the first visible
+// line or below it
+func (fv *fileView) startSearch(text string) error {
+	if err := fv.setSearch(text); err != nil || fv.search == nil {
+		return err
+	}
+	return fv.showMatch(fv.search.first(fv.topPosition()))
+}
+
+// nextMatch goes to the next occurrence of the searched text
+func (fv *fileView) nextMatch() error {
+	if fv.search == nil {
+		return nil
+	}
+	return fv.showMatch(fv.search.next(fv.topPosition()))
+}
+
+// previousMatch goes to the previous occurrence of the searched text
+func (fv *fileView) previousMatch() error {
+	if fv.search == nil {
+		return nil
+	}
+	return fv.showMatch(fv.search.previous(fv.topPosition()))
+}
+
+func (fv *fileView) filtersChanged() {
+	fv.p.setSource(fv.filters)
+	fv.render()
+}
+
+// viewer shows one of opened files at a time
+type viewer struct {
+	views         []*fileView
+	current       int
+	following     bool
+	prompting     bool // keys are typed into the prompt
+	promptName    string
+	submit        func(text string) error // called with text typed into the prompt
+	change        func(text string)       // called when text of the prompt changes, may be nil
+	filenameLabel *tui.Label
+	body          *tui.Box
+	promptLabel   *tui.Label
+	prompt        *tui.Entry
+	status        *tui.StatusBar // shows errors of reading the files
+}
+
+func newViewer(views []*fileView, following bool) *viewer {
+	result := &viewer{}
+	result.views = views
+	result.following = following
+	result.filenameLabel = tui.NewLabel("")
+	result.body = tui.NewVBox(views[0].fileLines)
+	result.promptLabel = tui.NewLabel("")
+	result.prompt = tui.NewEntry()
+	result.prompt.SetSizePolicy(tui.Expanding, tui.Maximum)
+	result.prompt.OnSubmit(result.submitPrompt)
+	result.status = tui.NewStatusBar("")
+	result.prompt.OnChanged(func(e *tui.Entry) {
+		if result.change != nil {
+			result.change(e.Text())
+		}
+	})
+	result.show(0)
+	return result
+}
+
+// startFilterPrompt lets the user type a filter narrowing the current view
+func (v *viewer) startFilterPrompt() {
+	if v.currentView().filters == nil {
+		v.promptLabel.SetText(errNoFilters.Error())
+		return
+	}
+	v.startPrompt("filter", v.currentView().pushFilter)
+}
+
+// startTimePrompt lets the user type time of the line to be shown
+func (v *viewer) startTimePrompt() {
+	v.startPrompt("go to time", v.currentView().goToTime)
+}
+
+// startSearchPrompt lets the user type text to be found, occurrences of it
+// are highlighted while typing. Text in slashes is a regexp
+func (v *viewer) startSearchPrompt() {
+	fv := v.currentView()
+	if fv.filters == nil {
+		v.promptLabel.SetText(errNoSearch.Error())
+		return
+	}
+	v.startPrompt("search", fv.startSearch)
+	v.change = func(text string) {
+		// incomplete regexps are not highlighted
+		fv.setSearch(text)
+	}
+}
+
+// findMatch goes to the next or previous occurrence of the searched text
+func (v *viewer) findMatch(find func() error) {
+	if err := find(); err != nil {
+		v.promptLabel.SetText(err.Error())
+	} else {
+		v.promptLabel.SetText("")
+	}
+	v.updateTitle()
+}
+
+// startPrompt lets the user type text passed to submit
+func (v *viewer) startPrompt(name string, submit func(text string) error) {
+	v.prompting = true
+	v.promptName = name
+	v.submit = submit
+	v.change = nil
+	v.promptLabel.SetText(name + ": ")
+	v.prompt.SetFocused(true)
+}
+
+func (v *viewer) endPrompt(message string) {
+	v.prompting = false
+	v.change = nil
+	v.prompt.SetFocused(false)
+	v.prompt.SetText("")
+	v.promptLabel.SetText(message)
+}
+
+func (v *viewer) submitPrompt(e *tui.Entry) {
+	if err := v.submit(e.Text()); err != nil {
+		v.promptLabel.SetText(fmt.Sprintf("%v (%v): ", v.promptName, err))
+		return
+	}
+	v.endPrompt("")
+	v.updateTitle()
+}
+
+func (v *viewer) currentView() *fileView {
+	return v.views[v.current]
+}
+
+func (v *viewer) show(index int) {
+	v.body.Remove(0)
+	v.current = (index + len(v.views)) % len(v.views)
+	v.body.Append(v.currentView().fileLines)
+	v.updateTitle()
+}
+
+func (v *viewer) updateTitle() {
+	title := v.currentView().name
+	if len(v.views) > 1 {
+		title = fmt.Sprintf("%v (%v/%v)", title, v.current+1, len(v.views))
+	}
+	if c, ok := v.currentView().p.src.(countable); ok {
+		if count, known := c.rowsCount(); known {
+			title += fmt.Sprintf(" [%v lines]", count)
+		}
+	}
+	if s, ok := v.currentView().p.src.(searching); ok {
+		if searched, total, running := s.progress(); running && total > 0 {
+			title += fmt.Sprintf(" [searching %v%%]", searched*100/total)
+		}
+	}
+	if ts := v.currentView().search; ts != nil && ts.counter() != "" {
+		title += fmt.Sprintf(" [%v]", ts.counter())
+	}
+	if fs := v.currentView().filters; fs != nil && fs.breadcrumbs() != "" {
+		title += fmt.Sprintf(" [filter: %v]", fs.breadcrumbs())
+	}
+	if v.currentView().wrap {
+		title += " [wrap]"
+	} else if offset := v.currentView().offset; offset > 0 {
+		title += fmt.Sprintf(" [column %v]", offset+1)
+	}
+	if v.following {
+		title += " [follow]"
+	}
+	v.filenameLabel.SetText(title)
+	v.updateStatus()
+}
+
+// updateStatus shows error of reading the file of the current view, so it is
+// not taken for an empty file
+func (v *viewer) updateStatus() {
+	f, ok := v.currentView().p.src.(failing)
+	if !ok || f.lastError() == nil {
+		v.status.SetText("")
+		return
+	}
+	v.status.SetText(fmt.Sprintf("error: %v", f.lastError()))
+}
+
+// toggleColors shows colors of ANSI escape codes in lines or strips them
+func (v *viewer) toggleColors() {
+	renderer := v.currentView().renderer
+	renderer.showColors = !renderer.showColors
+	for _, fv := range v.views {
+		fv.render()
+	}
+}
+
+// toggleFollowing turns follow mode on or off. When it is turned on, views
+// are scrolled to the end, so they keep showing new lines
+func (v *viewer) toggleFollowing() {
+	v.following = !v.following
+	for _, fv := range v.views {
+		fv.p.following = v.following
+		if v.following {
+			fv.p.end()
+			fv.render()
+		}
+	}
+	v.updateTitle()
+}
+
+// updateViews shows lines appended to the files and the ones found by filters
+func (v *viewer) updateViews() {
+	defer v.updateTitle()
+	for _, fv := range v.views {
+		change := fv.p.update()
+		if fv.search != nil {
+			if change == fileTruncated || change == fileRotated {
+				fv.search.stop()
+				fv.search = newTextSearch(fv.filters.tf, fv.search.pattern)
+			} else {
+				// the file was updated by the pager, only new lines are searched
+				fv.search.found.update()
+			}
+		}
+		switch change {
+		case fileUnchanged:
+			// wrapped lines are rendered again, when the screen was resized
+			if fv.wrap && fv.width != fv.screenWidth() {
+				fv.render()
+			}
+			continue
+		case fileTruncated:
+			fv.marker = fmt.Sprintf("--- file truncated at %v ---", time.Now().Format("15:04:05"))
+		case fileRotated:
+			fv.marker = fmt.Sprintf("--- file rotated at %v ---", time.Now().Format("15:04:05"))
+		}
+		fv.render()
+	}
+}
+
+// startPolling periodically checks files for new lines and filters for new
+// matches
+func (v *viewer) startPolling(ui tui.UI) {
+	go func() {
+		for range time.Tick(followInterval) {
+			ui.Update(v.updateViews)
+		}
+	}()
+}
+
+func (v *viewer) bindKeys(ui tui.UI) {
+	// keys typed into the prompt are not commands
+	bind := func(key string, action func()) {
+		ui.SetKeybinding(key, func() {
+			if !v.prompting {
+				action()
+			}
+		})
+	}
+	bindings := map[string]func(p *pager){
+		"Up":   func(p *pager) { p.scrollUp(1) },
+		"Down": func(p *pager) { p.scrollDown(1) },
+		"PgUp": (*pager).pageUp,
+		"PgDn": (*pager).pageDown,
+		"Home": (*pager).home,
+		"End":  (*pager).end,
+	}
+	for key, action := range bindings {
+		action := action
+		bind(key, func() {
+			action(v.currentView().p)
+			v.currentView().render()
+			v.updateStatus()
+		})
+	}
+	bind("}", func() {
+		v.currentView().p.nextRecord(v.currentView().recordStart())
+		v.currentView().render()
+	})
+	bind("{", func() {
+		v.currentView().p.previousRecord(v.currentView().recordStart())
+		v.currentView().render()
+	})
+	bind("]", func() { v.show(v.current + 1) })
+	bind("[", func() { v.show(v.current - 1) })
+	bind("F", v.toggleFollowing)
+	bind("a", v.toggleColors)
+	bind("w", func() {
+		v.currentView().toggleWrap()
+		v.updateTitle()
+	})
+	bind("Left", func() {
+		v.currentView().scrollHorizontally(-horizontalScrollStep)
+		v.updateTitle()
+	})
+	bind("Right", func() {
+		v.currentView().scrollHorizontally(horizontalScrollStep)
+		v.updateTitle()
+	})
+	bind("m", func() { v.findMatch(v.currentView().showMatchColumn) })
+	bind("&", v.startFilterPrompt)
+	bind("@", v.startTimePrompt)
+	bind("/", v.startSearchPrompt)
+	bind("n", func() { v.findMatch(v.currentView().nextMatch) })
+	bind("N", func() { v.findMatch(v.currentView().previousMatch) })
+	bind("-", func() {
+		v.currentView().popFilter()
+		v.updateTitle()
+	})
+	for layer := 1; layer <= 9; layer++ {
+		layer := layer
+		bind(strconv.Itoa(layer), func() {
+			v.currentView().toggleFilter(layer - 1)
+			v.updateTitle()
+		})
+	}
+	ui.SetKeybinding("Esc", func() {
+		if v.prompting {
+			if v.change != nil {
+				v.change("")
+			}
+			v.endPrompt("")
+		} else {
+			ui.Quit()
+		}
+	})
+}
+
+// newTheme returns styles of shown lines
+func newTheme(styles map[string]tui.Style) *tui.Theme {
+	theme := tui.NewTheme()
+	for name, style := range styles {
+		theme.SetStyle("label."+name, style)
+	}
+	for name, style := range ansiThemeStyles() {
+		theme.SetStyle("label."+name, style)
+	}
+	for n, color := range sourceColors {
+		theme.SetStyle(fmt.Sprintf("label.source%v", n), tui.Style{Fg: color})
+	}
+	return theme
+}
+
+func newUI(v *viewer) tui.Widget {
+
+	headersBox := tui.NewHBox(v.filenameLabel)
+	headersBox.SetBorder(true)
+
+	promptBox := tui.NewHBox(v.promptLabel, v.prompt)
+
+	return tui.NewVBox(headersBox, v.body, promptBox, v.status)
+}
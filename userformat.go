@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Formats of logs can be defined in a file like this:
+//
+//	# lines starting with # are comments
+//	[myapp]
+//	pattern = %{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} \[%{DATA:thread}\] %{GREEDYDATA:msg}
+//	detect = ^\d{4}-\d{2}-\d{2} .* \[
+//	time = 2006-01-02 15:04:05.000
+//
+// pattern is a regexp with named groups (?P<field>...), which can use grok
+// patterns as %{NAME} or %{NAME:field}. Lines matching it are in the format,
+// unless detect regexp is given. time is Go layout of the time field, known
+// timestamp formats are tried if it is not given.
+
+// grokPatterns are regexps, which can be referred to in patterns of formats
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"IP":                `(?:\d{1,3}\.){3}\d{1,3}|[A-Fa-f0-9:]*:[A-Fa-f0-9:.]+`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z\-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z\-]{0,62})*\.?\b`,
+	"LOGLEVEL":          `[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo|INFO|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"SYSLOGTIMESTAMP":   `[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`,
+	"HTTPDATE":          `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// expandGrok replaces references to grok patterns with their regexps
+func expandGrok(pattern string) (string, error) {
+	var err error
+	result := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		m := grokReference.FindStringSubmatch(ref)
+		p, ok := grokPatterns[m[1]]
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %v", m[1])
+			return ref
+		}
+		if m[2] == "" {
+			return "(?:" + p + ")"
+		}
+		return "(?P<" + m[2] + ">" + p + ")"
+	})
+	return result, err
+}
+
+// newUserFormat returns format of lines matching the pattern, fields are
+// named groups of the pattern
+func newUserFormat(name string, pattern string, detect string, timeLayout string) (*logFormat, error) {
+	expanded, err := expandGrok(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	names := re.SubexpNames()
+	hasFields := false
+	for _, n := range names {
+		hasFields = hasFields || n != ""
+	}
+	if !hasFields {
+		return nil, fmt.Errorf("pattern of format %v has no named groups", name)
+	}
+
+	result := &logFormat{}
+	result.name = name
+	result.timeLayout = timeLayout
+	result.parse = func(contents string) (logFields, bool) {
+		m := re.FindStringSubmatchIndex(contents)
+		if m == nil {
+			return nil, false
+		}
+		fields := logFields{}
+		for n, name := range names {
+			if name != "" && m[2*n] >= 0 {
+				fields[name] = contents[m[2*n]:m[2*n+1]]
+			}
+		}
+		return fields, true
+	}
+	if detect != "" {
+		detectRe, err := regexp.Compile(detect)
+		if err != nil {
+			return nil, err
+		}
+		result.detect = detectRe.MatchString
+	}
+	return result, nil
+}
+
+// readLogFormats reads definitions of formats
+func readLogFormats(r io.Reader, fileName string) ([]*logFormat, error) {
+	var result []*logFormat
+	var name string
+	var settings map[string]string
+	var nameLine int
+	add := func() error {
+		if name == "" {
+			return nil
+		}
+		if settings["pattern"] == "" {
+			return fmt.Errorf("%v:%v: format %v has no pattern", fileName, nameLine, name)
+		}
+		f, err := newUserFormat(name, settings["pattern"], settings["detect"], settings["time"])
+		if err != nil {
+			return fmt.Errorf("%v:%v: %v", fileName, nameLine, err)
+		}
+		result = append(result, f)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			if err := add(); err != nil {
+				return nil, err
+			}
+			name = strings.TrimSpace(line[1 : len(line)-1])
+			nameLine = lineNumber
+			settings = make(map[string]string)
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if name == "" || len(kv) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected [name] or key = value", fileName, lineNumber)
+		}
+		if key != "pattern" && key != "detect" && key != "time" {
+			return nil, fmt.Errorf("%v:%v: unknown setting %q", fileName, lineNumber, key)
+		}
+		settings[key] = strings.TrimSpace(kv[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := add(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// defaultFormatsPath returns path of the file with user defined formats
+func defaultFormatsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "logviewer", "formats.conf")
+}
+
+// loadLogFormats reads formats from the file and makes them known, before the
+// built-in ones. Missing file is an error, only if it must exist
+func loadLogFormats(path string, mustExist bool) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !mustExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	formats, err := readLogFormats(f, path)
+	if err != nil {
+		return err
+	}
+	logFormats = append(formats, builtinLogFormats...)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFormats = `# formats of our services
+[billing]
+pattern = ^%{TIMESTAMP_ISO8601:time} %{LOGLEVEL:level} \[%{DATA:thread}\] %{NOTSPACE:logger} - %{GREEDYDATA:msg}
+
+[gateway]
+pattern = ^(?P<time>\d{2}\.\d{2}\.\d{4} \d{2}:\d{2}) (?P<client>%{IP}) (?P<status>%{INT})(?: %{QS:agent})?
+detect = ^\d{2}\.\d{2}\.\d{4} 
+time = 02.01.2006 15:04
+`
+
+func TestUserFormats(t *testing.T) {
+	formats, err := readLogFormats(strings.NewReader(testFormats), "formats.conf")
+	if err != nil || len(formats) != 2 {
+		t.Fatalf("readLogFormats() want: 2 formats, have: %v %v", len(formats), err)
+	}
+	billing, gateway := formats[0], formats[1]
+
+	testCases := []struct {
+		format   *logFormat
+		contents string
+		expected logFields // nil if the line is not in the format
+	}{
+		{billing, "2019-11-25 10:00:01,250 WARN [main-1] c.e.Billing - charge failed",
+			logFields{"time": "2019-11-25 10:00:01,250", "level": "WARN", "thread": "main-1", "logger": "c.e.Billing", "msg": "charge failed"}},
+		{billing, "\tat c.e.Billing.charge(Billing.java:12)", nil},
+		{gateway, `25.11.2019 10:00 10.0.0.1 200 "curl/7.0"`,
+			logFields{"time": "25.11.2019 10:00", "client": "10.0.0.1", "status": "200", "agent": `"curl/7.0"`}},
+		{gateway, `25.11.2019 10:00 ::1 404`,
+			logFields{"time": "25.11.2019 10:00", "client": "::1", "status": "404"}},
+	}
+	for n, c := range testCases {
+		observed, ok := c.format.parse(c.contents)
+		if c.expected == nil {
+			if ok {
+				t.Errorf("Case %v: want: not in the format, have: %v", n, observed)
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(observed, c.expected) {
+			t.Errorf("Case %v: want: %v\nhave: %v %v", n, c.expected, observed, ok)
+		}
+	}
+
+	expected := time.Date(2019, 11, 25, 10, 0, 0, 0, time.UTC)
+	if observed, ok := gateway.timeOf("25.11.2019 10:00 10.0.0.1 200"); !ok || !observed.Equal(expected) {
+		t.Errorf("timeOf() want: %v, have: %v %v", expected, observed, ok)
+	}
+	// lines are detected by the detect regexp
+	if !gateway.matches("25.11.2019 10:00 invalid") || gateway.matches("10.0.0.1 200") {
+		t.Errorf("matches() does not use the detect regexp")
+	}
+	filter, _ := newFilter("status>=400", gateway.field)
+	if !filter(FileLine{Contents: "25.11.2019 10:00 ::1 404"}) {
+		t.Errorf("field of user format is not filtered")
+	}
+}
+
+func TestInvalidUserFormats(t *testing.T) {
+	testCases := []struct {
+		contents string
+		err      string
+	}{
+		{"pattern = (?P<a>x)\n", "f:1: expected [name] or key = value"},
+		{"[a]\npattern (?P<a>x)\n", "f:2: expected [name] or key = value"},
+		{"[a]\ncolor = red\n", `f:2: unknown setting "color"`},
+		{"[a]\ndetect = x\n", "f:1: format a has no pattern"},
+		{"[a]\npattern = %{NOPE:x}\n", "f:1: unknown grok pattern NOPE"},
+		{"[a]\npattern = (x\n", "f:1: error parsing regexp: missing closing ): `(x`"},
+		{"[a]\npattern = x+\n", "f:1: pattern of format a has no named groups"},
+		{"[a]\npattern = (?P<a>x)\n[b]\npattern = (?P<b>x)\ndetect = [\n", "f:3: error parsing regexp: missing closing ]: `[`"},
+	}
+
+	for n, c := range testCases {
+		if _, err := readLogFormats(strings.NewReader(c.contents), "f"); err == nil || err.Error() != c.err {
+			t.Errorf("Case %v: want: %v, have: %v", n, c.err, err)
+		}
+	}
+}
+
+func TestLoadingLogFormats(t *testing.T) {
+	defer func(formats []*logFormat) { logFormats = formats }(logFormats)
+	dir, err := ioutil.TempDir("", "logviewer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "formats.conf")
+	ioutil.WriteFile(path, []byte(testFormats), 0644)
+
+	if err := loadLogFormats(filepath.Join(dir, "missing.conf"), false); err != nil {
+		t.Errorf("loading missing optional file failed: %v", err)
+	}
+	if err := loadLogFormats(filepath.Join(dir, "missing.conf"), true); err == nil {
+		t.Errorf("loading missing required file succeeded")
+	}
+	if _, err := parseArgs([]string{"-formats", path, "-format", "billing", "a.log"}, ioutil.Discard); err != nil {
+		t.Errorf("parseArgs() with user format failed: %v", err)
+	}
+	lines := []string{
+		"2019-11-25 10:00:01,250 INFO [main] c.e.Billing - started",
+		"2019-11-25 10:00:02,000 ERROR [main] c.e.Billing - failed",
+		"\tat c.e.Billing.charge(Billing.java:12)",
+	}
+	if f := detectLogFormat(lines); f == nil || f.name != "billing" {
+		t.Errorf("detectLogFormat() want: billing, have: %v", f)
+	}
+}